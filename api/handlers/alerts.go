@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"crypto-sentiment/db"
+	"crypto-sentiment/internal/alerts"
+	"crypto-sentiment/internal/models"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultAlertCooldown applies to rules created without a cooldown
+	defaultAlertCooldown = time.Hour
+	defaultAlertEvents   = 50
+	maxAlertEvents       = 500
+)
+
+// AlertHandler manages alert rules. Secrets are returned only when a rule
+// is created.
+type AlertHandler struct {
+	manager *alerts.Manager
+}
+
+func NewAlertHandler(manager *alerts.Manager) *AlertHandler {
+	return &AlertHandler{manager: manager}
+}
+
+// ListAlerts returns every rule, or those for ?symbol=
+func (ah *AlertHandler) ListAlerts(c *gin.Context) {
+	rules, err := db.GetAlertRules(strings.ToUpper(c.Query("symbol")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load alerts"})
+		return
+	}
+
+	for i := range rules {
+		rules[i].Secret = ""
+	}
+	if rules == nil {
+		rules = []models.AlertRule{}
+	}
+	c.JSON(http.StatusOK, gin.H{"alerts": rules})
+}
+
+// CreateAlert adds a rule, e.g.
+// {"symbol": "BTC", "condition": "score_below", "threshold": -0.3,
+// "webhook_url": "https://example.com/hook", "cooldown": "1h"}.
+// A secret is generated unless one is given.
+func (ah *AlertHandler) CreateAlert(c *gin.Context) {
+	rule := models.AlertRule{
+		Enabled:  true,
+		Cooldown: models.Duration(defaultAlertCooldown),
+	}
+	if err := ah.bindRule(c, &rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rule.Secret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+		rule.Secret = secret
+	}
+
+	if err := db.CreateAlertRule(&rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save alert"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"alert": rule})
+}
+
+// GetAlert returns one rule
+func (ah *AlertHandler) GetAlert(c *gin.Context) {
+	rule, ok := loadRule(c)
+	if !ok {
+		return
+	}
+
+	rule.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"alert": rule})
+}
+
+// UpdateAlert changes the fields given in the body and leaves the others
+// as they are
+func (ah *AlertHandler) UpdateAlert(c *gin.Context) {
+	rule, ok := loadRule(c)
+	if !ok {
+		return
+	}
+
+	if err := ah.bindRule(c, rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rule.Secret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "secret must not be empty"})
+		return
+	}
+
+	if err := db.UpdateAlertRule(rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save alert"})
+		return
+	}
+
+	rule.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"alert": rule})
+}
+
+// DeleteAlert removes a rule along with its events
+func (ah *AlertHandler) DeleteAlert(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		return
+	}
+
+	if err := db.DeleteAlertRule(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete alert"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetAlertEvents returns the latest firings of a rule and their delivery
+// status, up to ?limit= (default 50, at most 500)
+func (ah *AlertHandler) GetAlertEvents(c *gin.Context) {
+	rule, ok := loadRule(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultAlertEvents
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxAlertEvents {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxAlertEvents)})
+			return
+		}
+		limit = parsed
+	}
+
+	events, err := db.GetAlertEvents(rule.ID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load alert events"})
+		return
+	}
+	if events == nil {
+		events = []models.AlertEvent{}
+	}
+	c.JSON(http.StatusOK, gin.H{"alert_id": rule.ID, "events": events})
+}
+
+// TestAlert sends a test payload to the rule's webhook right away and
+// reports whether it was accepted
+func (ah *AlertHandler) TestAlert(c *gin.Context) {
+	rule, ok := loadRule(c)
+	if !ok {
+		return
+	}
+
+	if err := ah.manager.Test(c.Request.Context(), *rule); err != nil {
+		// The cause stays in the log so that responses don't reveal what
+		// the server can reach
+		log.Printf("Alerts: test delivery of rule %d failed: %v", rule.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"delivered": false, "error": "Webhook delivery failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"delivered": true})
+}
+
+// loadRule fetches the rule named by the id parameter, writing the error
+// response if there is none
+func loadRule(c *gin.Context) (*models.AlertRule, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		return nil, false
+	}
+
+	rule, err := db.GetAlertRule(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load alert"})
+		return nil, false
+	}
+	return rule, true
+}
+
+// bindRule decodes the request body over rule and validates the result,
+// including whether its webhook may be delivered to. Fields managed by the
+// server can't be set.
+func (ah *AlertHandler) bindRule(c *gin.Context, rule *models.AlertRule) error {
+	id, createdAt, lastFiredAt := rule.ID, rule.CreatedAt, rule.LastFiredAt
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read body")
+	}
+	if err := json.Unmarshal(body, rule); err != nil {
+		return fmt.Errorf("invalid alert body: %v", err)
+	}
+	rule.ID, rule.CreatedAt, rule.LastFiredAt = id, createdAt, lastFiredAt
+
+	if err := alerts.Validate(rule); err != nil {
+		return err
+	}
+	return ah.manager.CheckTarget(c.Request.Context(), rule.WebhookURL)
+}
+
+// generateSecret returns a random webhook signing secret
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"crypto-sentiment/db"
+	"crypto-sentiment/internal/anomaly"
+	"crypto-sentiment/internal/models"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAnomalyLimit = 100
+	maxAnomalyLimit     = 1000
+	maxAnomalySymbols   = 50
+)
+
+// GetAnomalies flags stored results whose score or post count deviates
+// from each symbol's rolling baseline. ?symbols= defaults to the watched
+// symbols; ?threshold= and ?window= override the configured z-score
+// threshold and history window. The latest anomalies across all symbols
+// come first, up to ?limit= (default 100), along with a report of each
+// symbol's current deviation.
+func (sh *SentimentHandler) GetAnomalies(c *gin.Context) {
+	symbols := parseSymbols(c.Query("symbols"))
+	if len(symbols) == 0 {
+		symbols = sh.watchedSymbols()
+	}
+	if len(symbols) > maxAnomalySymbols {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d symbols", maxAnomalySymbols)})
+		return
+	}
+
+	config := sh.anomalies
+	if value := c.Query("threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'threshold', expected a positive z-score"})
+			return
+		}
+		config.Threshold = parsed
+	}
+	if value := c.Query("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'window', expected a positive duration such as 168h"})
+			return
+		}
+		config.Window = parsed
+	}
+
+	limit := defaultAnomalyLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxAnomalyLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid 'limit', expected 1 to %d", maxAnomalyLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	analyzed, err := sh.analyze(symbols, config, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sentiment history"})
+		return
+	}
+
+	reports := make([]anomaly.Report, 0, len(symbols))
+	anomalies := []anomaly.Anomaly{}
+	for _, symbol := range symbols {
+		report := analyzed[symbol]
+		reports = append(reports, report)
+		anomalies = append(anomalies, report.Anomalies...)
+	}
+
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return anomalies[i].Timestamp.After(anomalies[j].Timestamp)
+	})
+	if len(anomalies) > limit {
+		anomalies = anomalies[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"symbols":   reports,
+		"anomalies": anomalies,
+		"threshold": config.Threshold,
+		"alpha":     config.Alpha,
+		"warmup":    config.Warmup,
+		"window":    config.Window.String(),
+		"timestamp": time.Now(),
+	})
+}
+
+// analyze runs the anomaly detector over the stored history of each of
+// symbols within the window, loaded in one go. A symbol's latest result,
+// when given and newer than anything stored, is analyzed as the newest.
+func (sh *SentimentHandler) analyze(symbols []string, config anomaly.Config, latest map[string]*models.SentimentData) (map[string]anomaly.Report, error) {
+	to := time.Now()
+	ranges, err := db.GetSentimentRanges(symbols, to.Add(-config.Window), to)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make(map[string]anomaly.Report, len(symbols))
+	for _, symbol := range symbols {
+		rows := ranges[symbol]
+		if data := latest[symbol]; data != nil && (len(rows) == 0 || data.Timestamp.After(rows[len(rows)-1].Timestamp)) {
+			rows = append(rows, *data)
+		}
+		reports[symbol] = anomaly.Analyze(symbol, rows, config)
+	}
+	return reports, nil
+}
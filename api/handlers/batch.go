@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"crypto-sentiment/internal/fanout"
+	"crypto-sentiment/internal/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchSymbols caps the symbols of one batch request
+const maxBatchSymbols = 25
+
+// batchRequest is the body of GetSentimentBatch
+type batchRequest struct {
+	Symbols []string `json:"symbols"`
+	Sources []string `json:"sources"`
+	Fresh   bool     `json:"fresh"`
+}
+
+// GetSentimentBatch serves POST /api/v1/sentiment/batch with a body such
+// as {"symbols": ["BTC", "ETH"], "sources": ["reddit"], "fresh": false}.
+// Symbols are computed concurrently and reported in the order given, each
+// either with its sentiment or with an error. The request only fails, with
+// 503, when every symbol does.
+func (sh *SentimentHandler) GetSentimentBatch(c *gin.Context) {
+	var request batchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid batch body"})
+		return
+	}
+
+	symbols := parseSymbols(strings.Join(request.Symbols, ","))
+	if len(symbols) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbols is required"})
+		return
+	}
+	if len(symbols) > maxBatchSymbols {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d symbols per batch", maxBatchSymbols)})
+		return
+	}
+
+	query := sentimentQuery{fresh: request.Fresh}
+	if len(request.Sources) > 0 {
+		sources, err := sh.parseSources(request.Sources)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query.sources = sources
+	}
+
+	results := sh.sentimentBatch(c.Request.Context(), symbols, query)
+
+	entries := make([]gin.H, len(symbols))
+	failed := 0
+	complete := true
+	for i, result := range results {
+		entry := gin.H{
+			"symbol":     symbols[i],
+			"elapsed_ms": result.Elapsed.Milliseconds(),
+		}
+		data := result.Value
+		if data != nil {
+			entry["sources"] = data.Sources
+			entry["complete"] = result.Err == nil && data.Complete()
+		}
+
+		if result.Err != nil {
+			failed++
+			complete = false
+			entry["error"] = batchError(result.Err)
+			entry["complete"] = false
+		} else {
+			complete = complete && data.Complete()
+			entry["overall_score"] = data.Score
+			entry["total_posts"] = data.Posts
+			entry["timestamp"] = data.Timestamp
+		}
+		entries[i] = entry
+	}
+
+	status := http.StatusOK
+	response := gin.H{
+		"results":   entries,
+		"complete":  complete,
+		"failed":    failed,
+		"timestamp": time.Now(),
+	}
+	if failed == len(symbols) {
+		status = http.StatusServiceUnavailable
+		response["error"] = "Failed to fetch sentiment data"
+	}
+	c.JSON(status, response)
+}
+
+// sentimentBatch looks up the sentiment of symbols concurrently, bounded
+// by the fan-out settings, and returns the results in the same order. A
+// failed result keeps its per-source statuses when there are any.
+func (sh *SentimentHandler) sentimentBatch(ctx context.Context, symbols []string, query sentimentQuery) []fanout.Result[*models.SentimentData] {
+	return fanout.Run(ctx, symbols, sh.fanout, func(ctx context.Context, symbol string) (*models.SentimentData, error) {
+		data, _, err := sh.lookupSentiment(ctx, symbol, query)
+		return data, err
+	})
+}
+
+// batchError describes why a symbol of a batch has no result
+func batchError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "Timed out fetching sentiment data"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "Request cancelled"
+	}
+	return "Failed to fetch sentiment data"
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"crypto-sentiment/internal/catalog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultCoinSearchLimit = 25
+
+type CoinHandler struct {
+	coins *catalog.Catalog
+}
+
+func NewCoinHandler(coins *catalog.Catalog) *CoinHandler {
+	return &CoinHandler{coins: coins}
+}
+
+// SearchCoins lists catalog coins matching ?search= by id, ticker, name or
+// alias. Coins whose ticker is shared carry "ambiguous_symbol" so that
+// clients know to query by id instead.
+func (ch *CoinHandler) SearchCoins(c *gin.Context) {
+	limit := defaultCoinSearchLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit', expected a positive integer"})
+			return
+		}
+		limit = parsed
+	}
+
+	matches := ch.coins.Search(c.Query("search"), limit)
+
+	coins := make([]gin.H, len(matches))
+	for i, coin := range matches {
+		coins[i] = gin.H{
+			"id":               coin.ID,
+			"symbol":           coin.Symbol,
+			"name":             coin.Name,
+			"aliases":          coin.Aliases,
+			"subreddits":       coin.Subreddits,
+			"primary":          coin.Primary,
+			"ambiguous_symbol": ch.coins.IsAmbiguous(coin.Symbol),
+			"query_terms":      ch.coins.QueryTerms(coin.ID),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"coins": coins,
+		"count": len(coins),
+	})
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"crypto-sentiment/db"
+	"crypto-sentiment/internal/stats"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultCorrelationWindow   = 7 * 24 * time.Hour
+	defaultCorrelationInterval = time.Hour
+	defaultCorrelationMaxLag   = 6
+	maxCorrelationLag          = 48
+)
+
+// lagCorrelation is the correlation between sentiment and the price change
+// Lag buckets later. A positive lag means sentiment leads price.
+type lagCorrelation struct {
+	Lag         int      `json:"lag"`
+	Offset      string   `json:"offset"`
+	Correlation *float64 `json:"correlation"`
+	Samples     int      `json:"samples"`
+}
+
+// GetCorrelation correlates the stored sentiment for a symbol with its
+// price changes. Both series are bucketed by interval over the trailing
+// window, and the price change of a bucket is its percentage move from
+// the previous bucket. Coefficients are null when there are too few
+// samples or a series is constant.
+func (sh *SentimentHandler) GetCorrelation(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+
+	window := defaultCorrelationWindow
+	if value := c.Query("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'window', expected a positive duration such as 168h"})
+			return
+		}
+		window = parsed
+	}
+
+	interval := defaultCorrelationInterval
+	if value := c.Query("interval"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'interval', expected a positive duration such as 1h"})
+			return
+		}
+		interval = parsed
+	}
+
+	if window/interval > maxHistoryBuckets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Window too large for interval"})
+		return
+	}
+
+	maxLag := defaultCorrelationMaxLag
+	if value := c.Query("max_lag"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > maxCorrelationLag {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'max_lag', expected 0 to 48 buckets"})
+			return
+		}
+		maxLag = parsed
+	}
+
+	to := time.Now()
+	from := to.Add(-window)
+
+	sentimentHistory, err := db.GetSentimentHistory(symbol, from, to, interval)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sentiment history"})
+		return
+	}
+	priceHistory, err := db.GetPriceHistory(symbol, from, to, interval)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load price history"})
+		return
+	}
+
+	sentiment := make(map[time.Time]float64, len(sentimentHistory))
+	for _, point := range sentimentHistory {
+		sentiment[point.Timestamp] = point.Score
+	}
+
+	// Only consecutive buckets yield a price change
+	priceChange := make(map[time.Time]float64, len(priceHistory))
+	for i := 1; i < len(priceHistory); i++ {
+		previous, current := priceHistory[i-1], priceHistory[i]
+		if current.Timestamp.Sub(previous.Timestamp) == interval && previous.Price != 0 {
+			priceChange[current.Timestamp] = (current.Price - previous.Price) / previous.Price * 100
+		}
+	}
+
+	x, y := pairSeries(sentiment, priceChange, 0, interval)
+	response := gin.H{
+		"symbol":   symbol,
+		"window":   window.String(),
+		"interval": interval.String(),
+		"samples":  len(x),
+		"pearson":  optional(stats.Pearson(x, y)),
+		"spearman": optional(stats.Spearman(x, y)),
+	}
+
+	// Sized up front so that best keeps pointing into the final slice
+	crossCorrelation := make([]lagCorrelation, 0, 2*maxLag+1)
+	var best *lagCorrelation
+	for lag := -maxLag; lag <= maxLag; lag++ {
+		x, y := pairSeries(sentiment, priceChange, lag, interval)
+		entry := lagCorrelation{
+			Lag:         lag,
+			Offset:      (time.Duration(lag) * interval).String(),
+			Correlation: optional(stats.Pearson(x, y)),
+			Samples:     len(x),
+		}
+		crossCorrelation = append(crossCorrelation, entry)
+
+		if entry.Correlation != nil && (best == nil || math.Abs(*entry.Correlation) > math.Abs(*best.Correlation)) {
+			best = &crossCorrelation[len(crossCorrelation)-1]
+		}
+	}
+	response["cross_correlation"] = crossCorrelation
+	response["best_lag"] = best
+
+	c.JSON(http.StatusOK, response)
+}
+
+// pairSeries matches each sentiment bucket with the price change lag
+// buckets later and returns the paired values in time order
+func pairSeries(sentiment, priceChange map[time.Time]float64, lag int, interval time.Duration) ([]float64, []float64) {
+	times := make([]time.Time, 0, len(sentiment))
+	for t := range sentiment {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	var x, y []float64
+	offset := time.Duration(lag) * interval
+	for _, t := range times {
+		if change, ok := priceChange[t.Add(offset)]; ok {
+			x = append(x, sentiment[t])
+			y = append(y, change)
+		}
+	}
+	return x, y
+}
+
+// optional turns a (value, ok) pair into a JSON-friendly pointer
+func optional(value float64, ok bool) *float64 {
+	if !ok {
+		return nil
+	}
+	return &value
+}
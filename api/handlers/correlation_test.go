@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"crypto-sentiment/internal/stats"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPairSeries(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(bucket int) time.Time { return start.Add(time.Duration(bucket) * time.Hour) }
+
+	sentiment := map[time.Time]float64{at(0): 0.1, at(1): 0.2, at(2): 0.3}
+	priceChange := map[time.Time]float64{at(1): 1, at(2): 2, at(3): 3}
+
+	tests := []struct {
+		lag   int
+		wantX []float64
+		wantY []float64
+	}{
+		{0, []float64{0.2, 0.3}, []float64{1, 2}},
+		{1, []float64{0.1, 0.2, 0.3}, []float64{1, 2, 3}},
+		{-1, []float64{0.3}, []float64{1}},
+		{5, nil, nil},
+	}
+
+	for _, tt := range tests {
+		x, y := pairSeries(sentiment, priceChange, tt.lag, time.Hour)
+		if !reflect.DeepEqual(x, tt.wantX) || !reflect.DeepEqual(y, tt.wantY) {
+			t.Errorf("pairSeries(lag %d) = %v, %v, want %v, %v", tt.lag, x, y, tt.wantX, tt.wantY)
+		}
+	}
+}
+
+func TestLaggedCorrelationFindsLead(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	scores := []float64{0.1, -0.4, 0.3, 0.8, -0.2, 0.5, 0, -0.6}
+
+	// Price changes follow sentiment two buckets later
+	sentiment := make(map[time.Time]float64)
+	priceChange := make(map[time.Time]float64)
+	for i, score := range scores {
+		sentiment[start.Add(time.Duration(i)*time.Hour)] = score
+		priceChange[start.Add(time.Duration(i+2)*time.Hour)] = score * 10
+	}
+
+	x, y := pairSeries(sentiment, priceChange, 2, time.Hour)
+	if r, ok := stats.Pearson(x, y); !ok || math.Abs(r-1) > 1e-9 {
+		t.Errorf("correlation at lag 2 = %v, %v, want 1", r, ok)
+	}
+	x, y = pairSeries(sentiment, priceChange, 0, time.Hour)
+	if r, ok := stats.Pearson(x, y); !ok || math.Abs(r) > 0.9 {
+		t.Errorf("correlation at lag 0 = %v, %v, want a weak one", r, ok)
+	}
+	x, y = pairSeries(sentiment, priceChange, 8, time.Hour)
+	if _, ok := stats.Pearson(x, y); ok {
+		t.Errorf("correlation at lag 8 from %d pairs, want too few points", len(x))
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// weakETag derives a weak entity tag from the values a response is built
+// from. It is weak because the body may still differ in volatile fields
+// such as its age.
+func weakETag(values ...interface{}) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%v", values)))
+	return `W/"` + hex.EncodeToString(sum[:10]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using
+// the weak comparison that RFC 9110 prescribes for If-None-Match
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
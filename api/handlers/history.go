@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"crypto-sentiment/db"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultHistoryWindow   = 24 * time.Hour
+	defaultHistoryInterval = time.Hour
+	// maxHistoryBuckets stops a tiny interval over a long range from
+	// producing an unbounded response
+	maxHistoryBuckets = 1000
+)
+
+// GetSentimentHistory returns time-bucketed averages of the stored
+// sentiment for a symbol. from and to are RFC 3339 timestamps and default
+// to the last 24 hours; interval is a Go duration such as "15m" or "1h".
+func (sh *SentimentHandler) GetSentimentHistory(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' timestamp, expected RFC 3339"})
+			return
+		}
+		to = parsed
+	}
+
+	from := to.Add(-defaultHistoryWindow)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' timestamp, expected RFC 3339"})
+			return
+		}
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'from' must be before 'to'"})
+		return
+	}
+
+	interval := defaultHistoryInterval
+	if value := c.Query("interval"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'interval', expected a positive duration such as 1h"})
+			return
+		}
+		interval = parsed
+	}
+
+	if to.Sub(from)/interval > maxHistoryBuckets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Range too large for interval"})
+		return
+	}
+
+	history, err := db.GetSentimentHistory(symbol, from, to, interval)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sentiment history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"symbol":   symbol,
+		"from":     from.UTC(),
+		"to":       to.UTC(),
+		"interval": interval.String(),
+		"history":  history,
+	})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"crypto-sentiment/internal/lexicon"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LexiconHandler struct {
+	manager *lexicon.Manager
+}
+
+func NewLexiconHandler(manager *lexicon.Manager) *LexiconHandler {
+	return &LexiconHandler{manager: manager}
+}
+
+// GetLexicon returns the active dictionary with its version
+func (lh *LexiconHandler) GetLexicon(c *gin.Context) {
+	c.JSON(http.StatusOK, lh.manager.Current())
+}
+
+// PatchLexicon sets or removes terms, e.g.
+// {"set": {"wagmi": 1.2, "ngmi": -1.2}, "remove": ["long"]}
+func (lh *LexiconHandler) PatchLexicon(c *gin.Context) {
+	var patch lexicon.Patch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patch body"})
+		return
+	}
+
+	dictionary, err := lh.manager.Apply(patch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dictionary)
+}
+
+// ReloadLexicon re-reads the lexicon files immediately
+func (lh *LexiconHandler) ReloadLexicon(c *gin.Context) {
+	if err := lh.manager.Load(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, lh.manager.Current())
+}
+
+// GetLexiconVersions lists the retained dictionary versions
+func (lh *LexiconHandler) GetLexiconVersions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"active":   lh.manager.Current().Version,
+		"versions": lh.manager.Versions(),
+	})
+}
+
+// RollbackLexicon reactivates a retained version
+func (lh *LexiconHandler) RollbackLexicon(c *gin.Context) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	dictionary, err := lh.manager.Rollback(version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dictionary)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"crypto-sentiment/db"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPostsPageSize = 50
+	maxPostsPageSize     = 200
+)
+
+// GetSentimentPosts returns the individually scored posts behind the
+// current sentiment for a symbol, strongest sentiment first. Supports
+// ?page=, ?page_size=, ?sign=positive|negative|neutral and ?source=.
+func (sh *SentimentHandler) GetSentimentPosts(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
+
+	page := 1
+	if value := c.Query("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'page', expected a positive integer"})
+			return
+		}
+		page = parsed
+	}
+
+	pageSize := defaultPostsPageSize
+	if value := c.Query("page_size"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPostsPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'page_size', expected 1 to 200"})
+			return
+		}
+		pageSize = parsed
+	}
+
+	filter := db.PostFilter{
+		Sign:     strings.ToLower(c.Query("sign")),
+		Platform: strings.ToLower(c.Query("source")),
+		Limit:    pageSize,
+		Offset:   (page - 1) * pageSize,
+	}
+	switch filter.Sign {
+	case "", "positive", "negative", "neutral":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'sign', expected positive, negative or neutral"})
+		return
+	}
+
+	data, err := sh.sentimentData(c.Request.Context(), symbol)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sentiment data"})
+		return
+	}
+
+	posts, total, err := db.GetPosts(data.ID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load posts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"symbol":        symbol,
+		"sentiment_id":  data.ID,
+		"overall_score": data.Score,
+		"timestamp":     data.Timestamp,
+		"page":          page,
+		"page_size":     pageSize,
+		"total":         total,
+		"posts":         posts,
+	})
+}
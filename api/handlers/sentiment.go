@@ -1,135 +1,431 @@
 package handlers
 
 import (
+	"context"
+	"crypto-sentiment/db"
+	"crypto-sentiment/internal/anomaly"
+	"crypto-sentiment/internal/cache"
+	"crypto-sentiment/internal/catalog"
+	"crypto-sentiment/internal/collector"
+	"crypto-sentiment/internal/fanout"
+	"crypto-sentiment/internal/hub"
+	"crypto-sentiment/internal/models"
+	"crypto-sentiment/internal/ratelimit"
 	"crypto-sentiment/internal/services"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
-	"os"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// defaultTrendingSymbols stand in for the collector watchlist when there
+// is no collector, e.g. for GetTrending before any posts are stored
+var defaultTrendingSymbols = []string{"BTC", "ETH", "BNB", "XRP", "DOGE"}
+
 type SentimentHandler struct {
-	redditService     *services.RedditService
-	twitterService    *services.TwitterService
-	sentimentAnalyzer *services.SentimentAnalyzer
-	twitterEnabled    bool
+	sentimentService *services.SentimentService
+	coinService      *services.CoinService
+	collector        *collector.Collector
+	events           *hub.Hub
+	upstream         *ratelimit.Transport
+	anomalies        anomaly.Config
+	fanout           fanout.Config
+	// results holds live computations so that concurrent and repeated
+	// requests for a symbol share one
+	results *cache.Cache[string, *models.SentimentData]
 }
 
-func NewSentimentHandler() *SentimentHandler {
-	// Initialize base services
-	handler := &SentimentHandler{
-		redditService:     services.NewRedditService(),
-		sentimentAnalyzer: services.NewSentimentAnalyzer(),
-	}
+// computeError carries a computation in which every source failed, so that
+// the statuses can be reported without the result being cached
+type computeError struct {
+	data *models.SentimentData
+	err  error
+}
 
-	// Check if Twitter credentials are provided
-	if apiKey := strings.TrimSpace(os.Getenv("TWITTER_API_KEY")); apiKey != "" {
-		var err error
-		handler.twitterService, err = services.NewTwitterService()
-		if err == nil {
-			handler.twitterEnabled = true
-		}
-	}
+func (e *computeError) Error() string {
+	return e.err.Error()
+}
 
-	return handler
+// SentimentConfig sets the optional collaborators and tuning of a
+// SentimentHandler
+type SentimentConfig struct {
+	// Collector, when given, serves watched symbols from the data it
+	// stores instead of fetching them on every request
+	Collector *collector.Collector
+	// Events receives the results computed from every source, like the
+	// collector's
+	Events *hub.Hub
+	// Upstream is the transport whose rate limit state HealthCheck reports
+	Upstream *ratelimit.Transport
+	// ResultTTL is how long live results are reused, and then served for
+	// as long again while they are recomputed. With zero only concurrent
+	// requests share one.
+	ResultTTL time.Duration
+	// Anomalies configures the detector behind GetAnomalies and the
+	// trending ranking
+	Anomalies anomaly.Config
+	// FanOut bounds the symbols GetTrending and GetSentimentBatch compute
+	// at once
+	FanOut fanout.Config
 }
 
-func (sh *SentimentHandler) GetSentiment(c *gin.Context) {
-	symbol := c.Param("symbol")
+// NewSentimentHandler wires the handler onto its services
+func NewSentimentHandler(sentimentService *services.SentimentService, coinService *services.CoinService, config SentimentConfig) *SentimentHandler {
+	return &SentimentHandler{
+		sentimentService: sentimentService,
+		coinService:      coinService,
+		collector:        config.Collector,
+		events:           config.Events,
+		upstream:         config.Upstream,
+		anomalies:        config.Anomalies,
+		fanout:           config.FanOut,
+		results: cache.New[string, *models.SentimentData](cache.Config{
+			TTL:      config.ResultTTL,
+			StaleTTL: config.ResultTTL,
+		}),
+	}
+}
 
-	var (
-		redditPosts []services.RedditPost
-		tweets      []services.Tweet
-		redditErr   error
-		wg          sync.WaitGroup
-	)
+// GetSentiment returns the current sentiment for a symbol. With
+// ?include_price=true the response also carries the coin's market data.
+// ?strategy=, ?min_confidence= and ?trim= re-aggregate the same posts with
+// different settings. Every source's status is reported and complete is
+// false when any of them failed; only when none delivered posts does the
+// request fail.
+//
+// Results are cached per symbol and ?sources= set. ?fresh=true recomputes
+// them, and the cache block tells whether a response was cached and how
+// old it is. Responses carry an ETag and Last-Modified, and a matching
+// If-None-Match gets 304 Not Modified.
+func (sh *SentimentHandler) GetSentiment(c *gin.Context) {
+	symbol := strings.ToUpper(c.Param("symbol"))
 
-	// Always fetch Reddit data
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		redditPosts, redditErr = sh.redditService.FetchPosts(symbol)
-	}()
-
-	// Only fetch Twitter data if enabled
-	var twitterErr error
-	if sh.twitterEnabled {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			tweets, twitterErr = sh.twitterService.FetchTweets(symbol)
-		}()
-	}
-
-	wg.Wait()
-
-	// Handle Reddit errors
-	if redditErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to fetch Reddit data",
-		})
+	aggregator, custom, err := sh.aggregatorFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	sources, err := sh.sourcesFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fresh, _ := strconv.ParseBool(c.Query("fresh"))
 
-	// Analyze Reddit sentiment
-	var redditScore float64
-	var redditResults []services.SentimentResult
-	for _, post := range redditPosts {
-		result := sh.sentimentAnalyzer.AnalyzeText(post.Title + " " + post.SelfText)
-		redditResults = append(redditResults, result)
-		redditScore += result.Score
+	data, lookup, err := sh.lookupSentiment(c.Request.Context(), symbol, sentimentQuery{sources: sources, fresh: fresh})
+	if err != nil {
+		response := gin.H{"error": "Failed to fetch sentiment data"}
+		status := http.StatusInternalServerError
+		if data != nil {
+			response["symbol"] = data.Symbol
+			response["sources"] = data.Sources
+			response["complete"] = false
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, response)
+		return
 	}
-	if len(redditResults) > 0 {
-		redditScore /= float64(len(redditResults))
+
+	if custom {
+		if data, err = reaggregate(data, aggregator); err != nil {
+			log.Printf("Error loading posts for %s: %v", symbol, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to aggregate sentiment data",
+			})
+			return
+		}
 	}
 
-	// Initialize response
 	response := gin.H{
-		"symbol":       symbol,
-		"reddit_score": redditScore,
-		"reddit_posts": len(redditResults),
-		"timestamp":    time.Now(),
+		"symbol":        data.Symbol,
+		"overall_score": data.Score,
+		"sources":       data.Sources,
+		"complete":      data.Complete(),
+		"reddit_score":  data.Reddit,
+		"reddit_posts":  data.RedditPosts,
+		"timestamp":     data.Timestamp,
+	}
+	if data.Aggregation != nil {
+		response["aggregation"] = data.Aggregation
 	}
 
 	// Add Twitter data if enabled and successfully fetched
-	if sh.twitterEnabled {
-		if twitterErr == nil {
-			var twitterScore float64
-			var twitterResults []services.SentimentResult
-			for _, tweet := range tweets {
-				result := sh.sentimentAnalyzer.AnalyzeText(tweet.Text)
-				twitterResults = append(twitterResults, result)
-				twitterScore += result.Score
-			}
-			if len(twitterResults) > 0 {
-				twitterScore /= float64(len(twitterResults))
+	if data.Twitter != nil {
+		response["twitter_score"] = *data.Twitter
+		response["tweets"] = data.Tweets
+	} else if twitter, ok := data.Sources["twitter"]; ok && twitter.Status == models.SourceError {
+		response["twitter_error"] = "Failed to fetch Twitter data"
+	}
+
+	// The ETag covers everything the body is built from except its age
+	version := []interface{}{data.Symbol, data.ID, data.Timestamp.UnixNano(), sources, aggregator}
+	if includePrice, _ := strconv.ParseBool(c.Query("include_price")); includePrice {
+		coin, err := sh.coinData(c.Request.Context(), symbol)
+		var ambiguous *catalog.AmbiguousError
+		if errors.As(err, &ambiguous) {
+			response["price_error"] = ambiguous.Error()
+		} else if err != nil {
+			response["price_error"] = "Failed to fetch price data"
+		} else {
+			response["price"] = coin
+			version = append(version, coin.LastUpdated.UnixNano())
+		}
+	}
+
+	etag := weakETag(version...)
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", data.Timestamp.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	response["cache"] = gin.H{
+		"cached":      lookup.Cached,
+		"stale":       lookup.Stale,
+		"age_seconds": math.Round(time.Since(data.Timestamp).Seconds()),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// watchedSymbols returns the collector's watchlist, or the default
+// trending symbols when there is no collector
+func (sh *SentimentHandler) watchedSymbols() []string {
+	if sh.collector != nil {
+		return sh.collector.Symbols()
+	}
+	return defaultTrendingSymbols
+}
+
+// aggregatorFromQuery starts from the service's default aggregation and
+// applies any strategy, min_confidence or trim query parameters. custom
+// reports whether any were given.
+func (sh *SentimentHandler) aggregatorFromQuery(c *gin.Context) (services.Aggregator, bool, error) {
+	aggregator := sh.sentimentService.Aggregator()
+	custom := false
+
+	if value := c.Query("strategy"); value != "" {
+		aggregator.Strategy = strings.ToLower(value)
+		// A trim fraction only carries over between trimmed strategies
+		aggregator.TrimFraction = 0
+		custom = true
+	}
+	if value := c.Query("min_confidence"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return aggregator, false, errors.New("min_confidence must be a number")
+		}
+		aggregator.MinConfidence = parsed
+		custom = true
+	}
+	if value := c.Query("trim"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return aggregator, false, errors.New("trim must be a number")
+		}
+		// Zero would fall back to the default trim rather than trim nothing
+		if parsed == 0 && aggregator.Strategy == services.StrategyTrimmed {
+			return aggregator, false, errors.New("trim must be above 0 for the trimmed strategy, use strategy=mean for no trimming")
+		}
+		aggregator.TrimFraction = parsed
+		custom = true
+	}
+
+	if err := aggregator.Validate(); err != nil {
+		return aggregator, false, err
+	}
+	return aggregator, custom, nil
+}
+
+// reaggregate recomputes a copy of data's scores with aggregator, loading
+// its posts from the database when data was served from storage. data
+// itself may be cached and is left untouched.
+func reaggregate(cached *models.SentimentData, aggregator services.Aggregator) (*models.SentimentData, error) {
+	data := *cached
+	data.Sources = make(map[string]models.SourceSentiment, len(cached.Sources))
+	for name, source := range cached.Sources {
+		data.Sources[name] = source
+	}
+
+	if data.AnalyzedPosts == nil && data.ID != 0 {
+		posts, _, err := db.GetPosts(data.ID, db.PostFilter{})
+		if err != nil {
+			return nil, err
+		}
+		data.AnalyzedPosts = posts
+	}
+	services.Aggregate(&data, aggregator)
+	return &data, nil
+}
+
+// HealthCheck reports which sources are enabled, the rate limit state of
+// every upstream contacted so far and the cache statistics
+func (sh *SentimentHandler) HealthCheck(c *gin.Context) {
+	sources := gin.H{"twitter": false}
+	for _, name := range sh.sentimentService.SourceNames() {
+		sources[name] = true
+	}
+
+	upstreams := []ratelimit.HostStatus{}
+	if sh.upstream != nil {
+		upstreams = sh.upstream.Status()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "healthy",
+		"services":  sources,
+		"collector": sh.collector != nil,
+		"upstreams": upstreams,
+		"caches": gin.H{
+			"sentiment": sh.results.Stats(),
+			"prices":    sh.coinService.CacheStats(),
+		},
+	})
+}
+
+// sentimentQuery selects the sentiment result a request wants
+type sentimentQuery struct {
+	// sources limits the computation to these sources; nil means all
+	sources []string
+	// fresh skips the cache and the collector's stored result
+	fresh bool
+}
+
+// sentimentData returns the current sentiment for symbol from every source
+func (sh *SentimentHandler) sentimentData(ctx context.Context, symbol string) (*models.SentimentData, error) {
+	data, _, err := sh.lookupSentiment(ctx, symbol, sentimentQuery{})
+	return data, err
+}
+
+// lookupSentiment returns the stored sentiment for symbol while the
+// collector keeps it fresh, and otherwise computes it live, sharing the
+// result through the cache keyed by symbol and source set. Results from
+// every source are also stored and published, so that alert rules see
+// every result whichever request computed it. A computation in which every
+// source failed is returned along with the error but neither stored,
+// published nor cached. The result must not be modified.
+func (sh *SentimentHandler) lookupSentiment(ctx context.Context, symbol string, query sentimentQuery) (*models.SentimentData, cache.Lookup, error) {
+	if sh.collector != nil && query.sources == nil && !query.fresh {
+		if interval, ok := sh.collector.Interval(symbol); ok {
+			stored, err := db.GetLatestSentiment(symbol)
+			// Allow one missed round before falling back to a live fetch
+			if err == nil && time.Since(stored.Timestamp) < 2*interval {
+				return stored, cache.Lookup{Cached: true}, nil
 			}
+		}
+	}
 
-			response["twitter_score"] = twitterScore
-			response["tweets"] = len(twitterResults)
+	names := query.sources
+	if names == nil {
+		names = sh.sentimentService.SourceNames()
+		sort.Strings(names)
+	}
+	key := symbol + "|" + strings.Join(names, ",")
 
-			// Calculate overall sentiment
-			totalPosts := len(redditResults) + len(twitterResults)
-			if totalPosts > 0 {
-				overallScore := (redditScore*float64(len(redditResults)) +
-					twitterScore*float64(len(twitterResults))) / float64(totalPosts)
-				response["overall_score"] = overallScore
+	load := func(ctx context.Context) (*models.SentimentData, error) {
+		data, err := sh.sentimentService.ComputeSources(ctx, symbol, query.sources)
+		if err != nil {
+			return nil, &computeError{data: data, err: err}
+		}
+
+		if query.sources == nil {
+			if err := db.SaveSentiment(data); err != nil {
+				log.Printf("Failed to save sentiment for %s: %v", symbol, err)
+			}
+			if sh.events != nil {
+				sh.events.Publish(hub.SentimentEvent(data))
 			}
-		} else {
-			response["twitter_error"] = "Failed to fetch Twitter data"
 		}
+		return data, nil
+	}
+
+	var (
+		data   *models.SentimentData
+		lookup cache.Lookup
+		err    error
+	)
+	if query.fresh {
+		data, err = sh.results.Reload(ctx, key, load)
 	} else {
-		// If Twitter is disabled, overall score is just Reddit score
-		response["overall_score"] = redditScore
+		data, lookup, err = sh.results.GetOrLoad(ctx, key, load)
 	}
 
-	c.JSON(http.StatusOK, response)
+	var failed *computeError
+	if errors.As(err, &failed) {
+		return failed.data, lookup, failed.err
+	}
+	return data, lookup, err
+}
+
+// sourcesFromQuery parses ?sources=, a comma-separated list of enabled
+// sources, into a sorted set. It returns nil when the parameter is missing
+// or names every enabled source.
+func (sh *SentimentHandler) sourcesFromQuery(c *gin.Context) ([]string, error) {
+	value := c.Query("sources")
+	if value == "" {
+		return nil, nil
+	}
+	return sh.parseSources(strings.Split(value, ","))
+}
+
+// parseSources checks that every name is an enabled source and returns
+// them as a sorted set, or nil when they name every enabled source
+func (sh *SentimentHandler) parseSources(values []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range values {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if !sh.sentimentService.HasSource(name) {
+			return nil, fmt.Errorf("unknown or disabled source %q", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("sources must name at least one source")
+	}
+
+	sort.Strings(names)
+	if len(names) == len(sh.sentimentService.SourceNames()) {
+		return nil, nil
+	}
+	return names, nil
+}
+
+// coinData fetches the market data for symbol and stores it as a price
+// sample for the correlation endpoint, unless the sample is already stored
+func (sh *SentimentHandler) coinData(ctx context.Context, symbol string) (*services.CoinData, error) {
+	coin, err := sh.coinService.GetCoinData(ctx, symbol)
+	if err != nil {
+		log.Printf("Price error for %s: %v", symbol, err)
+		return nil, err
+	}
+
+	_, err = db.SavePrice(&models.PriceData{
+		Symbol:         symbol,
+		Price:          coin.CurrentPrice,
+		PriceChange24h: coin.PriceChange24h,
+		MarketCap:      coin.MarketCap,
+		Timestamp:      coin.LastUpdated,
+	})
+	if err != nil {
+		log.Printf("Failed to save price for %s: %v", symbol, err)
+	}
+	return coin, nil
 }
 
 // Add a method to check if Twitter is enabled
 func (sh *SentimentHandler) IsTwitterEnabled() bool {
-	return sh.twitterEnabled
+	return sh.sentimentService.HasSource("twitter")
 }
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"crypto-sentiment/internal/services"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAggregatorFromQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sh := &SentimentHandler{
+		sentimentService: services.NewSentimentService(nil, nil, services.DefaultAggregator()),
+	}
+
+	tests := []struct {
+		query      string
+		want       services.Aggregator
+		wantCustom bool
+		wantErr    bool
+	}{
+		{"", services.DefaultAggregator(), false, false},
+		{"strategy=MEAN", services.Aggregator{Strategy: services.StrategyMean}, true, false},
+		{"strategy=trimmed", services.Aggregator{Strategy: services.StrategyTrimmed, TrimFraction: 0.1}, true, false},
+		{"strategy=trimmed&trim=0.2&min_confidence=0.3", services.Aggregator{Strategy: services.StrategyTrimmed, TrimFraction: 0.2, MinConfidence: 0.3}, true, false},
+		// An explicit zero would silently become the default trim
+		{"strategy=trimmed&trim=0", services.Aggregator{}, false, true},
+		{"strategy=mean&trim=0", services.Aggregator{Strategy: services.StrategyMean}, true, false},
+		{"strategy=trimmed&trim=0.5", services.Aggregator{}, false, true},
+		{"trim=lots", services.Aggregator{}, false, true},
+		{"min_confidence=2", services.Aggregator{}, false, true},
+		{"strategy=median", services.Aggregator{}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/sentiment/BTC?"+tt.query, nil)
+
+			got, custom, err := sh.aggregatorFromQuery(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("aggregatorFromQuery() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got != tt.want || custom != tt.wantCustom {
+				t.Errorf("aggregatorFromQuery() = %+v, %v, want %+v, %v", got, custom, tt.want, tt.wantCustom)
+			}
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"context"
+	"crypto-sentiment/internal/catalog"
+	"crypto-sentiment/internal/hub"
+	"crypto-sentiment/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// Defaults for the StreamConfig limits
+const (
+	defaultStreamMaxSymbols = 10
+	defaultStreamMaxLive    = 50
+	defaultStreamHeartbeat  = 15 * time.Second
+	defaultStreamInterval   = time.Minute
+	defaultStreamBuffer     = 32
+	// streamWriteTimeout is how long a client may take to accept a frame
+	// before it is disconnected
+	streamWriteTimeout = 10 * time.Second
+	// snapshotTimeout bounds the initial update sent for each symbol
+	snapshotTimeout = 20 * time.Second
+)
+
+// StreamConfig sets the limits of the streaming endpoints. Zero values
+// take their defaults.
+type StreamConfig struct {
+	// MaxSymbols caps the symbols a single connection may follow
+	MaxSymbols int
+	// MaxLive caps the distinct symbols the collector doesn't watch that
+	// all connections together may follow, since Run recomputes each of
+	// them every Interval
+	MaxLive int
+	// Heartbeat is how often an idle connection gets a heartbeat frame
+	Heartbeat time.Duration
+	// Interval is how often symbols the collector doesn't watch are
+	// recomputed for their subscribers
+	Interval time.Duration
+	// Buffer is how many updates are queued for a slow client before the
+	// oldest are dropped
+	Buffer int
+}
+
+// StreamHandler pushes sentiment and price updates to clients over
+// Server-Sent Events and WebSocket. Updates come from the hub, which the
+// collector publishes to; Run covers the symbols the collector doesn't.
+type StreamHandler struct {
+	sentiment *SentimentHandler
+	events    *hub.Hub
+	config    StreamConfig
+	// subscribeMutex makes checking MaxLive and subscribing one step
+	subscribeMutex sync.Mutex
+}
+
+func NewStreamHandler(sentimentHandler *SentimentHandler, events *hub.Hub, config StreamConfig) *StreamHandler {
+	if config.MaxSymbols <= 0 {
+		config.MaxSymbols = defaultStreamMaxSymbols
+	}
+	if config.MaxLive <= 0 {
+		config.MaxLive = defaultStreamMaxLive
+	}
+	if config.Heartbeat <= 0 {
+		config.Heartbeat = defaultStreamHeartbeat
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultStreamInterval
+	}
+	if config.Buffer <= 0 {
+		config.Buffer = defaultStreamBuffer
+	}
+
+	return &StreamHandler{
+		sentiment: sentimentHandler,
+		events:    events,
+		config:    config,
+	}
+}
+
+// Run recomputes every subscribed symbol the collector doesn't watch once
+// per Interval until ctx is done. New sentiment results are published by
+// the computation itself; Run publishes the prices that changed.
+func (st *StreamHandler) Run(ctx context.Context) {
+	ticker := time.NewTicker(st.config.Interval)
+	defer ticker.Stop()
+
+	// published remembers the last update of each kind per symbol, so that
+	// cached results aren't sent again
+	published := make(map[string]time.Time)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, symbol := range st.events.Symbols() {
+			if st.watched(symbol) {
+				continue
+			}
+
+			refreshCtx, cancel := context.WithTimeout(ctx, st.config.Interval)
+			for _, event := range st.updates(refreshCtx, symbol) {
+				if event.Type == hub.EventSentiment {
+					continue
+				}
+				key := event.Type + "/" + event.Symbol
+				if event.Timestamp.After(published[key]) {
+					published[key] = event.Timestamp
+					st.events.Publish(event)
+				}
+			}
+			cancel()
+		}
+	}
+}
+
+// StreamSSE serves GET /api/v1/stream?symbols=BTC,ETH as Server-Sent
+// Events. Each symbol's current sentiment and price are sent first, then
+// every update as a "sentiment" or "price" event. A "heartbeat" event,
+// which also reports how many updates were dropped because the client fell
+// behind, keeps idle connections open.
+func (st *StreamHandler) StreamSSE(c *gin.Context) {
+	symbols, err := st.resolveSymbols(parseSymbols(c.Query("symbols")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := st.checkLimit(len(symbols)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(symbols) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbols is required"})
+		return
+	}
+
+	sub := st.events.Subscribe(st.config.Buffer)
+	defer sub.Close()
+	if err := st.subscribe(sub, symbols); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	go st.snapshot(ctx, sub, symbols)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	controller := http.NewResponseController(c.Writer)
+	write := func(event string, data interface{}) error {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		// Not every writer supports deadlines; those rely on the client
+		controller.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+
+	heartbeat := time.NewTicker(st.config.Heartbeat)
+	defer heartbeat.Stop()
+	if err := write("subscribed", gin.H{"symbols": symbols}); err != nil {
+		return
+	}
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-sub.Events():
+			if sub.Has(event.Symbol) {
+				err = write(event.Type, event)
+			}
+		case <-heartbeat.C:
+			err = write("heartbeat", heartbeatFrame(sub))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// streamMessage is sent by WebSocket clients
+type streamMessage struct {
+	Action  string   `json:"action"`
+	Symbols []string `json:"symbols"`
+}
+
+// StreamWebSocket serves GET /api/v1/ws. Clients send
+// {"action":"subscribe","symbols":["BTC"]} and
+// {"action":"unsubscribe","symbols":["BTC"]}, and may subscribe up front
+// with ?symbols=. They receive the same updates as StreamSSE as JSON
+// messages with a "type" field, plus "subscribed" acknowledgements,
+// "heartbeat" messages and "error" messages for rejected requests.
+func (st *StreamHandler) StreamWebSocket(c *gin.Context) {
+	initial, err := st.resolveSymbols(parseSymbols(c.Query("symbols")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := st.checkLimit(len(initial)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := st.checkLive(initial); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	server := websocket.Server{
+		// Origins are not restricted, as with CORS on the rest of the API
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			st.serveWebSocket(conn, initial)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+func (st *StreamHandler) serveWebSocket(conn *websocket.Conn, initial []string) {
+	defer conn.Close()
+
+	sub := st.events.Subscribe(st.config.Buffer)
+	defer sub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Only this goroutine writes; the reader hands it replies
+	replies := make(chan interface{}, 8)
+	subscribe := func(symbols []string) {
+		var reply interface{}
+		if err := st.subscribe(sub, symbols); err != nil {
+			reply = gin.H{"type": "error", "error": err.Error()}
+		} else {
+			go st.snapshot(ctx, sub, symbols)
+			reply = gin.H{"type": "subscribed", "symbols": sub.Symbols()}
+		}
+		select {
+		case replies <- reply:
+		case <-ctx.Done():
+		}
+	}
+	if len(initial) > 0 {
+		subscribe(initial)
+	}
+
+	go func() {
+		defer cancel()
+		for {
+			var message streamMessage
+			if err := websocket.JSON.Receive(conn, &message); err != nil {
+				return
+			}
+
+			var reply interface{}
+			switch strings.ToLower(message.Action) {
+			case "subscribe":
+				symbols, err := st.resolveSymbols(parseSymbols(strings.Join(message.Symbols, ",")))
+				if err != nil {
+					reply = gin.H{"type": "error", "error": err.Error()}
+					break
+				}
+				var added []string
+				for _, symbol := range symbols {
+					if !sub.Has(symbol) {
+						added = append(added, symbol)
+					}
+				}
+				if err := st.checkLimit(len(sub.Symbols()) + len(added)); err != nil {
+					reply = gin.H{"type": "error", "error": err.Error()}
+					break
+				}
+				subscribe(added)
+				continue
+			case "unsubscribe":
+				for _, symbol := range parseSymbols(strings.Join(message.Symbols, ",")) {
+					if coin, err := st.sentiment.coinService.Catalog().Resolve(symbol); err == nil {
+						symbol = coin.Symbol
+					}
+					sub.Remove(symbol)
+				}
+				reply = gin.H{"type": "subscribed", "symbols": sub.Symbols()}
+			default:
+				reply = gin.H{"type": "error", "error": fmt.Sprintf("unknown action %q", message.Action)}
+			}
+
+			select {
+			case replies <- reply:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(st.config.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		var message interface{}
+		select {
+		case <-ctx.Done():
+			return
+		case reply := <-replies:
+			message = reply
+		case event := <-sub.Events():
+			if !sub.Has(event.Symbol) {
+				continue
+			}
+			message = event
+		case <-heartbeat.C:
+			frame := heartbeatFrame(sub)
+			frame["type"] = "heartbeat"
+			message = frame
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if err := websocket.JSON.Send(conn, message); err != nil {
+			return
+		}
+	}
+}
+
+// parseSymbols splits a comma-separated list into unique uppercase symbols
+func parseSymbols(value string) []string {
+	seen := make(map[string]bool)
+	var symbols []string
+	for _, symbol := range strings.Split(value, ",") {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		if symbol == "" || seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// checkLimit rejects following more than MaxSymbols symbols on one
+// connection
+func (st *StreamHandler) checkLimit(count int) error {
+	if count > st.config.MaxSymbols {
+		return fmt.Errorf("at most %d symbols per connection", st.config.MaxSymbols)
+	}
+	return nil
+}
+
+// resolveSymbols maps symbols, which may also be coin ids or names, to
+// their catalog tickers. Symbols the catalog doesn't know or can't tell
+// apart are rejected, so that streams only follow real coins.
+func (st *StreamHandler) resolveSymbols(symbols []string) ([]string, error) {
+	seen := make(map[string]bool, len(symbols))
+	resolved := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		coin, err := st.sentiment.coinService.Catalog().Resolve(symbol)
+		var ambiguous *catalog.AmbiguousError
+		if errors.As(err, &ambiguous) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unknown symbol %s", symbol)
+		}
+		if !seen[coin.Symbol] {
+			seen[coin.Symbol] = true
+			resolved = append(resolved, coin.Symbol)
+		}
+	}
+	return resolved, nil
+}
+
+// subscribe adds symbols to sub unless that would take the live symbols
+// past MaxLive
+func (st *StreamHandler) subscribe(sub *hub.Subscription, symbols []string) error {
+	st.subscribeMutex.Lock()
+	defer st.subscribeMutex.Unlock()
+
+	if err := st.checkLive(symbols); err != nil {
+		return err
+	}
+	for _, symbol := range symbols {
+		sub.Add(symbol)
+	}
+	return nil
+}
+
+// checkLive rejects following symbols when the distinct symbols the
+// collector doesn't watch, across every connection, would exceed MaxLive
+func (st *StreamHandler) checkLive(symbols []string) error {
+	live := make(map[string]bool)
+	for _, symbol := range append(st.events.Symbols(), symbols...) {
+		if !st.watched(symbol) {
+			live[symbol] = true
+		}
+	}
+	if len(live) > st.config.MaxLive {
+		return fmt.Errorf("streams already follow the limit of %d symbols outside the watchlist", st.config.MaxLive)
+	}
+	return nil
+}
+
+// watched reports whether the collector keeps symbol up to date, so that
+// Run need not
+func (st *StreamHandler) watched(symbol string) bool {
+	if st.sentiment.collector == nil {
+		return false
+	}
+	_, watched := st.sentiment.collector.Interval(symbol)
+	return watched
+}
+
+// snapshot sends the current sentiment and price of symbols to sub alone,
+// so that new subscribers don't wait for the next update
+func (st *StreamHandler) snapshot(ctx context.Context, sub *hub.Subscription, symbols []string) {
+	ctx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancel()
+
+	for _, symbol := range symbols {
+		for _, event := range st.updates(ctx, symbol) {
+			sub.Send(event)
+		}
+	}
+}
+
+// updates returns the current sentiment and price events for symbol,
+// leaving out whichever can't be fetched
+func (st *StreamHandler) updates(ctx context.Context, symbol string) []hub.Event {
+	var events []hub.Event
+	if data, err := st.sentiment.sentimentData(ctx, symbol); err != nil {
+		log.Printf("Stream: sentiment for %s failed: %v", symbol, err)
+	} else {
+		events = append(events, hub.SentimentEvent(data))
+	}
+
+	if coin, err := st.sentiment.coinData(ctx, symbol); err == nil {
+		events = append(events, hub.PriceEvent(&models.PriceData{
+			Symbol:         symbol,
+			Price:          coin.CurrentPrice,
+			PriceChange24h: coin.PriceChange24h,
+			MarketCap:      coin.MarketCap,
+			Timestamp:      coin.LastUpdated,
+		}))
+	}
+	return events
+}
+
+func heartbeatFrame(sub *hub.Subscription) gin.H {
+	return gin.H{"timestamp": time.Now(), "dropped": sub.Dropped()}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"crypto-sentiment/db"
+	"crypto-sentiment/internal/models"
+	"crypto-sentiment/internal/trending"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTrendingLimit = 10
+	maxTrendingLimit     = 50
+	// trendingMaxAge is how old a stored result may be to rank a coin the
+	// collector doesn't watch without computing it again
+	trendingMaxAge = 15 * time.Minute
+)
+
+// Rankings that need each coin's current sentiment, on top of the
+// trending package's mention rankings
+const (
+	rankDeviation = "deviation"
+	rankScore     = "score"
+)
+
+// GetTrending discovers the coins mentioned in the collected posts, by
+// cashtag, ticker or name, and ranks them. ?rank=velocity (the default)
+// ranks by the growth of the hourly mention rate within ?window= (default
+// 1h) over the ?baseline= before it (default 6h); shift by the change in
+// the sentiment of the mentioning posts; mentions by count; deviation by
+// the anomaly z-score of each coin's stored sentiment; score by its
+// current sentiment. Coins mentioned fewer than ?min_mentions= times
+// (default 3) are left out, and the top ?limit= (default 10) are returned
+// with sample posts. Until posts have been collected, the watched symbols
+// are reported instead and source is "watchlist". Each coin's latest
+// stored result is used while fresh; the others are computed concurrently,
+// each under the fan-out timeout. Coins whose computation failed are
+// listed under failed, keeping any older stored result, and complete is
+// false. Coins without any sentiment are listed without a score.
+func (sh *SentimentHandler) GetTrending(c *gin.Context) {
+	rank := c.DefaultQuery("rank", trending.RankVelocity)
+	switch rank {
+	case trending.RankVelocity, trending.RankShift, trending.RankMentions, rankDeviation, rankScore:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'rank', expected velocity, shift, mentions, deviation or score"})
+		return
+	}
+
+	var config trending.Config
+	for name, setting := range map[string]*time.Duration{
+		"window":   &config.Window,
+		"baseline": &config.Baseline,
+	} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid '%s', expected a positive duration such as 1h", name)})
+				return
+			}
+			*setting = parsed
+		}
+	}
+	if value := c.Query("min_mentions"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'min_mentions', expected a positive count"})
+			return
+		}
+		config.MinMentions = parsed
+	}
+	if err := config.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if config.Window+config.Baseline > db.PostRetention {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Window and baseline may span at most %s, the post retention", db.PostRetention)})
+		return
+	}
+
+	limit := defaultTrendingLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxTrendingLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid 'limit', expected 1 to %d", maxTrendingLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	now := time.Now()
+	posts, err := db.GetRecentPosts(now.Add(-config.Window - config.Baseline))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load posts"})
+		return
+	}
+
+	source := "posts"
+	trends := trending.Discover(posts, sh.coinService.Catalog(), now, config)
+	if len(trends) == 0 {
+		source = "watchlist"
+		for _, symbol := range sh.watchedSymbols() {
+			trends = append(trends, trending.Trend{Symbol: symbol})
+		}
+	}
+
+	// Mention rankings pick the top coins up front; the others rank the
+	// most mentioned ones once their sentiment is known
+	if rank != rankDeviation && rank != rankScore {
+		trending.Sort(trends, rank)
+	}
+	if len(trends) > limit {
+		trends = trends[:limit]
+	}
+
+	symbols := make([]string, len(trends))
+	for i, trend := range trends {
+		symbols[i] = trend.Symbol
+	}
+	current, err := db.GetLatestSentiments(symbols)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sentiment data"})
+		return
+	}
+
+	// Fresh stored results stand in for live ones; the others are
+	// computed concurrently
+	var stale []string
+	for _, symbol := range symbols {
+		if data, ok := current[symbol]; !ok || !sh.fresh(data) {
+			stale = append(stale, symbol)
+		}
+	}
+	failed := []gin.H{}
+	results := sh.sentimentBatch(c.Request.Context(), stale, sentimentQuery{})
+	for i, symbol := range stale {
+		if err := results[i].Err; err != nil {
+			// An older stored result, if any, is still reported
+			failed = append(failed, gin.H{"symbol": symbol, "error": batchError(err)})
+			continue
+		}
+		current[symbol] = results[i].Value
+	}
+
+	reports, err := sh.analyze(symbols, sh.anomalies, current)
+	if err != nil {
+		log.Printf("Trending: analyzing deviations failed: %v", err)
+	}
+
+	type entry struct {
+		score     *float64
+		deviation *float64
+		values    gin.H
+	}
+	entries := make([]entry, 0, len(trends))
+	for _, trend := range trends {
+		values := gin.H{"symbol": trend.Symbol}
+		if source == "posts" {
+			values["name"] = trend.Name
+			values["mentions"] = trend.Mentions
+			values["baseline_mentions"] = trend.BaselineMentions
+			values["mention_delta"] = trend.MentionDelta
+			values["mention_score"] = trend.MentionScore
+			values["score_delta"] = trend.ScoreDelta
+			values["sample_posts"] = trend.SamplePosts
+		}
+
+		// Coins without any sentiment are listed without a score
+		var e entry
+		if data := current[trend.Symbol]; data != nil {
+			report := reports[trend.Symbol]
+			e.score, e.deviation = &data.Score, report.Deviation
+			values["score"] = data.Score
+			values["posts"] = data.Posts
+			values["sentiment_timestamp"] = data.Timestamp
+			values["deviation"] = report.Deviation
+			values["anomalous"] = report.Anomalous
+			if report.Score != nil {
+				values["score_z"] = report.Score.ZScore
+				values["posts_z"] = report.Posts.ZScore
+			}
+		}
+		e.values = values
+		entries = append(entries, e)
+	}
+
+	// Coins without a score, or too little history for a deviation, rank
+	// last
+	less := func(a, b *float64) bool {
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return *a > *b
+	}
+	switch rank {
+	case rankScore:
+		sort.SliceStable(entries, func(i, j int) bool {
+			return less(entries[i].score, entries[j].score)
+		})
+	case rankDeviation:
+		sort.SliceStable(entries, func(i, j int) bool {
+			return less(entries[i].deviation, entries[j].deviation)
+		})
+	}
+
+	result := make([]gin.H, len(entries))
+	for i, e := range entries {
+		result[i] = e.values
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"trending":  result,
+		"rank":      rank,
+		"source":    source,
+		"complete":  len(failed) == 0,
+		"failed":    failed,
+		"window":    config.Window.String(),
+		"baseline":  config.Baseline.String(),
+		"timestamp": now,
+	})
+}
+
+// fresh reports whether stored may stand in for a live result: younger
+// than trendingMaxAge, or kept up to date by the collector as in
+// lookupSentiment
+func (sh *SentimentHandler) fresh(stored *models.SentimentData) bool {
+	age := time.Since(stored.Timestamp)
+	if age < trendingMaxAge {
+		return true
+	}
+	if sh.collector != nil {
+		if interval, ok := sh.collector.Interval(stored.Symbol); ok {
+			return age < 2*interval
+		}
+	}
+	return false
+}
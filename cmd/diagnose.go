@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto-sentiment/db"
+	"crypto-sentiment/internal/diagnose"
+	"crypto-sentiment/internal/lexicon"
+	"crypto-sentiment/internal/ratelimit"
+	"crypto-sentiment/internal/services"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runDiagnose checks every configured upstream, the database and the
+// lexicon, prints the results and returns the process exit code: 0 when
+// nothing failed, 1 when a check failed and 2 on bad usage. Credentials
+// and tokens are never printed.
+func runDiagnose(args []string) int {
+	flags := flag.NewFlagSet("diagnose", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the results as JSON")
+	symbol := flags.String("symbol", "BTC", "symbol to search for and price")
+	timeout := flags.Duration("timeout", 15*time.Second, "timeout of each check")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	coins := loadCatalog()
+
+	// Record each response before the rate limiter sees it, and don't
+	// retry so that latencies reflect a single request
+	recorder := &diagnose.Recorder{}
+	config := ratelimit.DefaultConfig()
+	config.MaxRetries = 0
+	transport := ratelimit.NewTransport(recorder, config)
+
+	reddit := redditConfig()
+	twitter := twitterConfig()
+	redditService := services.NewRedditService(reddit, coins, transport)
+	coinService := services.NewCoinService(os.Getenv("COINGECKO_BASE_URL"), coins, transport)
+	// The auth check hands its service to the search check. Checks run on
+	// their own goroutine, which outlives a check that timed out, so the
+	// service is passed over a channel rather than a shared variable.
+	twitterAuth := make(chan *services.TwitterService, 1)
+
+	redditSkip := ""
+	if reddit.ClientID == "" {
+		redditSkip = "REDDIT_CLIENT_ID not set"
+	}
+	twitterSkip := ""
+	if twitter.APIKey == "" {
+		twitterSkip = "TWITTER_API_KEY not set"
+	}
+
+	checks := []diagnose.Check{
+		{
+			Name:       "reddit auth",
+			SkipReason: redditSkip,
+			Run: func(ctx context.Context) (string, error) {
+				if err := redditService.Authenticate(ctx); err != nil {
+					return "", err
+				}
+				return "access token obtained", nil
+			},
+		},
+		{
+			Name:       "reddit search",
+			SkipReason: redditSkip,
+			Run: func(ctx context.Context) (string, error) {
+				posts, err := redditService.FetchPosts(ctx, *symbol)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%d posts for %s", len(posts), *symbol), nil
+			},
+		},
+		{
+			Name:       "twitter auth",
+			SkipReason: twitterSkip,
+			Run: func(ctx context.Context) (string, error) {
+				service, err := services.NewTwitterService(ctx, twitter, coins, transport)
+				if err != nil {
+					return "", err
+				}
+				twitterAuth <- service
+				return "bearer token obtained", nil
+			},
+		},
+		{
+			Name:       "twitter search",
+			SkipReason: twitterSkip,
+			Run: func(ctx context.Context) (string, error) {
+				var twitterService *services.TwitterService
+				select {
+				case twitterService = <-twitterAuth:
+				default:
+					return "", fmt.Errorf("not authenticated")
+				}
+				if err := twitterService.TestConnection(ctx); err != nil {
+					return "", err
+				}
+				return "recent search succeeded", nil
+			},
+		},
+		{
+			Name: "coingecko price",
+			Run: func(ctx context.Context) (string, error) {
+				coin, err := coinService.GetCoinData(ctx, *symbol)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%s at %.2f USD", coin.Symbol, coin.CurrentPrice), nil
+			},
+		},
+		{
+			Name: "database",
+			Run: func(ctx context.Context) (string, error) {
+				path := databasePath()
+				if _, err := os.Stat(path); err != nil {
+					return "", err
+				}
+				if err := db.OpenReadOnly(path); err != nil {
+					return "", err
+				}
+				if err := db.Ping(); err != nil {
+					return "", err
+				}
+				return path, nil
+			},
+		},
+		{
+			Name: "lexicon",
+			Run: func(ctx context.Context) (string, error) {
+				manager := lexicon.NewManager(os.Getenv("LEXICON_DIR"), services.NewSentimentAnalyzer())
+				if err := manager.Load(); err != nil {
+					return "", err
+				}
+				current := manager.Current()
+				return fmt.Sprintf("version %d (%s), %d positive and %d negative terms",
+					current.Version, current.Source, len(current.Positive), len(current.Negative)), nil
+			},
+		},
+	}
+
+	secrets := []string{reddit.ClientSecret, twitter.APISecret, os.Getenv("ADMIN_TOKEN")}
+	results := diagnose.Run(context.Background(), checks, recorder, *timeout, secrets)
+
+	var err error
+	if *asJSON {
+		err = diagnose.WriteJSON(os.Stdout, results)
+	} else {
+		err = diagnose.WriteTable(os.Stdout, results)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if !diagnose.Passed(results) {
+		return 1
+	}
+	return 0
+}
@@ -1,57 +1,42 @@
 package main
 
 import (
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
+	"context"
+	"crypto-sentiment/api/handlers"
+	"crypto-sentiment/api/middleware"
+	"crypto-sentiment/db"
+	"crypto-sentiment/internal/alerts"
+	"crypto-sentiment/internal/anomaly"
+	"crypto-sentiment/internal/catalog"
+	"crypto-sentiment/internal/collector"
+	"crypto-sentiment/internal/fanout"
+	"crypto-sentiment/internal/hub"
+	"crypto-sentiment/internal/lexicon"
+	"crypto-sentiment/internal/mockupstream"
+	"crypto-sentiment/internal/ratelimit"
+	"crypto-sentiment/internal/services"
+	"errors"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
-type Tweet struct {
-	Text string `json:"text"`
-}
-
-type RedditPost struct {
-	Title    string `json:"title"`
-	SelfText string `json:"selftext"`
-}
-
-// Global variable to store X Bearer Token
-var xBearerToken string
-var twitterEnabled bool
-
 func init() {
 	// Load .env file
 	if err := godotenv.Load(); err != nil {
 		log.Printf("Warning: .env file not found")
 	}
 
-	// Check if Twitter credentials are provided
-	if apiKey := strings.TrimSpace(os.Getenv("TWITTER_API_KEY")); apiKey != "" {
-		// Initialize X Bearer Token only if credentials are provided
-		var err error
-		xBearerToken, err = getXBearerToken()
-		if err != nil {
-			log.Printf("Warning: Failed to initialize X Bearer Token: %v", err)
-			twitterEnabled = false
-		} else {
-			twitterEnabled = true
-			log.Println("Twitter integration enabled")
-		}
-	} else {
-		log.Println("Twitter integration disabled - no API credentials provided")
-		twitterEnabled = false
-	}
-
 	// Create necessary directories
 	createRequiredDirectories()
 }
@@ -104,26 +89,65 @@ func createRequiredDirectories() {
 }
 
 func main() {
-	// Check if we're running in test mode
-	if len(os.Args) > 1 && os.Args[1] == "test-apis" {
-		testAPIs()
-		return
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		// test-apis is the command's former name
+		case "diagnose", "test-apis":
+			os.Exit(runDiagnose(os.Args[2:]))
+		case "mock-upstreams":
+			runMockUpstreams()
+			return
+		}
 	}
 
-	// Normal server startup
-	r := gin.Default()
+	dbPath := databasePath()
+	if err := db.InitDB(dbPath); err != nil {
+		log.Fatalf("Failed to initialize database %s: %v", dbPath, err)
+	}
 
-	// Basic CORS middleware
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		c.Next()
+	coins := loadCatalog()
+
+	// One transport for every upstream so that quotas are tracked per host
+	// across all services
+	upstream := ratelimit.NewTransport(nil, ratelimit.DefaultConfig())
+
+	sources := services.NewSourceRegistry(
+		services.NewRedditService(redditConfig(), coins, upstream),
+	)
+	if twitterService, reason := newTwitterService(coins, upstream); twitterService != nil {
+		sources.Register(twitterService)
+	} else {
+		sources.Disable("twitter", reason)
+	}
+
+	sentimentAnalyzer := services.NewSentimentAnalyzer()
+	lexiconManager := lexicon.NewManager(os.Getenv("LEXICON_DIR"), sentimentAnalyzer)
+	if err := lexiconManager.Load(); err != nil {
+		log.Fatalf("Failed to load lexicon: %v", err)
+	}
+
+	sentimentService := services.NewSentimentService(sources, sentimentAnalyzer, loadAggregator())
+	coinService := services.NewCoinService(os.Getenv("COINGECKO_BASE_URL"), coins, upstream)
+	events := hub.New()
+	dataCollector := newCollector(sentimentService, coinService, events)
+
+	sentimentHandler := handlers.NewSentimentHandler(sentimentService, coinService, handlers.SentimentConfig{
+		Collector: dataCollector,
+		Events:    events,
+		Upstream:  upstream,
+		ResultTTL: sentimentCacheTTL(),
+		Anomalies: anomalyConfig(),
+		FanOut:    fanoutConfig(),
 	})
+	coinHandler := handlers.NewCoinHandler(coins)
+	streamHandler := handlers.NewStreamHandler(sentimentHandler, events, streamConfig())
+	alertManager := alerts.NewManager(events, alerts.NewWebhook(webhookConfig()))
+	alertHandler := handlers.NewAlertHandler(alertManager)
+	adminToken := os.Getenv("ADMIN_TOKEN")
+
+	// Normal server startup
+	r := gin.Default()
+	r.Use(middleware.CORSMiddleware())
 
 	// Serve static files
 	r.Static("/static", "./frontend/static")
@@ -137,11 +161,52 @@ func main() {
 	})
 
 	// API routes
-	api := r.Group("/api/v1")
+	api := r.Group("/api/v1", middleware.TimeoutMiddleware(requestTimeout()))
+	{
+		api.GET("/health", sentimentHandler.HealthCheck)
+		api.GET("/sentiment/:symbol", sentimentHandler.GetSentiment)
+		api.POST("/sentiment/batch", sentimentHandler.GetSentimentBatch)
+		api.GET("/sentiment/:symbol/history", sentimentHandler.GetSentimentHistory)
+		api.GET("/sentiment/:symbol/posts", sentimentHandler.GetSentimentPosts)
+		api.GET("/trending", sentimentHandler.GetTrending)
+		api.GET("/anomalies", sentimentHandler.GetAnomalies)
+		api.GET("/correlation/:symbol", sentimentHandler.GetCorrelation)
+		api.GET("/coins", coinHandler.SearchCoins)
+	}
+
+	// Alert rules hold webhook secrets and make the server send requests,
+	// so they always require the admin token; without one every request is
+	// rejected
+	alertRoutes := api.Group("/alerts", middleware.AdminAuthMiddleware(adminToken))
+	{
+		alertRoutes.GET("", alertHandler.ListAlerts)
+		alertRoutes.POST("", alertHandler.CreateAlert)
+		alertRoutes.GET("/:id", alertHandler.GetAlert)
+		alertRoutes.PUT("/:id", alertHandler.UpdateAlert)
+		alertRoutes.DELETE("/:id", alertHandler.DeleteAlert)
+		alertRoutes.GET("/:id/events", alertHandler.GetAlertEvents)
+		alertRoutes.POST("/:id/test", alertHandler.TestAlert)
+	}
+
+	// Streams stay open, so they are exempt from the request timeout
+	stream := r.Group("/api/v1")
 	{
-		api.GET("/health", healthCheck)
-		api.GET("/sentiment/:symbol", getSentiment)
-		api.GET("/trending", getTrending)
+		stream.GET("/stream", streamHandler.StreamSSE)
+		stream.GET("/ws", streamHandler.StreamWebSocket)
+	}
+
+	// Admin routes are only served when a token is configured
+	if adminToken != "" {
+		lexiconHandler := handlers.NewLexiconHandler(lexiconManager)
+
+		admin := api.Group("/admin", middleware.AdminAuthMiddleware(adminToken))
+		{
+			admin.GET("/lexicon", lexiconHandler.GetLexicon)
+			admin.PATCH("/lexicon", lexiconHandler.PatchLexicon)
+			admin.POST("/lexicon/reload", lexiconHandler.ReloadLexicon)
+			admin.GET("/lexicon/versions", lexiconHandler.GetLexiconVersions)
+			admin.POST("/lexicon/versions/:version/rollback", lexiconHandler.RollbackLexicon)
+		}
 	}
 
 	port := os.Getenv("PORT")
@@ -149,407 +214,476 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Server starting on port %s", port)
-	r.Run(":" + port)
-}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-func getXBearerToken() (string, error) {
-	apiKey := os.Getenv("TWITTER_API_KEY")
-	apiSecret := os.Getenv("TWITTER_API_SECRET")
+	reloadInterval := 10 * time.Second
+	if value := os.Getenv("LEXICON_RELOAD_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid LEXICON_RELOAD_INTERVAL %q", value)
+		}
+		reloadInterval = parsed
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		lexiconManager.Watch(ctx, reloadInterval)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		streamHandler.Run(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		alertManager.Run(ctx)
+	}()
+
+	if dataCollector != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dataCollector.Run(ctx)
+		}()
+	}
+
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
 
-	// Encode credentials
-	credentials := base64.StdEncoding.EncodeToString(
-		[]byte(fmt.Sprintf("%s:%s", apiKey, apiSecret)))
+	<-ctx.Done()
+	log.Println("Shutting down...")
 
-	// Create request for bearer token
-	req, err := http.NewRequest(
-		"POST",
-		"https://api.twitter.com/oauth2/token",
-		strings.NewReader("grant_type=client_credentials"),
-	)
-	if err != nil {
-		return "", err
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown failed: %v", err)
 	}
+	wg.Wait()
+}
 
-	req.Header.Add("Authorization", "Basic "+credentials)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+// loadCatalog reads the coin catalog from COIN_CATALOG_PATH, falling back
+// to the catalog bundled with the binary
+func loadCatalog() *catalog.Catalog {
+	if path := os.Getenv("COIN_CATALOG_PATH"); path != "" {
+		coins, err := catalog.LoadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to load coin catalog %s: %v", path, err)
+		}
+		return coins
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	coins, err := catalog.Default()
 	if err != nil {
-		return "", err
+		log.Fatalf("Failed to load bundled coin catalog: %v", err)
 	}
-	defer resp.Body.Close()
+	return coins
+}
 
-	var result struct {
-		AccessToken string `json:"access_token"`
+// loadAggregator reads the default aggregation from AGGREGATION_STRATEGY,
+// AGGREGATION_MIN_CONFIDENCE and AGGREGATION_TRIM
+func loadAggregator() services.Aggregator {
+	aggregator := services.DefaultAggregator()
+	if value := os.Getenv("AGGREGATION_STRATEGY"); value != "" {
+		aggregator.Strategy = strings.ToLower(value)
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if value := os.Getenv("AGGREGATION_MIN_CONFIDENCE"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatalf("Invalid AGGREGATION_MIN_CONFIDENCE %q", value)
+		}
+		aggregator.MinConfidence = parsed
 	}
-
-	return result.AccessToken, nil
-}
-
-func testAPIs() {
-	fmt.Println("Testing API Connections...")
-
-	// Test Reddit API
-	fmt.Println("\n1. Testing Reddit API:")
-	testRedditAPI()
-
-	// Test X (Twitter) API only if enabled
-	if twitterEnabled {
-		fmt.Println("\n2. Testing X (Twitter) API:")
-		testXAPI()
-	} else {
-		fmt.Println("\n2. X (Twitter) API: Disabled")
+	if value := os.Getenv("AGGREGATION_TRIM"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatalf("Invalid AGGREGATION_TRIM %q", value)
+		}
+		if parsed == 0 && aggregator.Strategy == services.StrategyTrimmed {
+			log.Fatalf("Invalid AGGREGATION_TRIM %q, the trimmed strategy needs a fraction above 0", value)
+		}
+		aggregator.TrimFraction = parsed
 	}
-}
-
-func testRedditAPI() {
-	clientID := os.Getenv("REDDIT_CLIENT_ID")
-	clientSecret := os.Getenv("REDDIT_CLIENT_SECRET")
 
-	authString := base64.StdEncoding.EncodeToString(
-		[]byte(fmt.Sprintf("%s:%s", clientID, clientSecret)))
-
-	data := url.Values{}
-	data.Set("grant_type", "client_credentials")
-
-	req, err := http.NewRequest(
-		"POST",
-		"https://www.reddit.com/api/v1/access_token",
-		strings.NewReader(data.Encode()),
-	)
-	if err != nil {
-		log.Fatal("Reddit request creation failed:", err)
+	if err := aggregator.Validate(); err != nil {
+		log.Fatalf("Invalid aggregation settings: %v", err)
 	}
+	return aggregator
+}
 
-	req.Header.Add("Authorization", "Basic "+authString)
-	req.Header.Add("User-Agent", "CryptoSentimentBot/1.0")
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal("Reddit API call failed:", err)
+// newCollector builds the background collector from COLLECTOR_* settings.
+// It returns nil when COLLECTOR_ENABLED is false, in which case every
+// request is served live.
+func newCollector(sentimentService *services.SentimentService, coinService *services.CoinService, events *hub.Hub) *collector.Collector {
+	if enabled, err := strconv.ParseBool(os.Getenv("COLLECTOR_ENABLED")); err == nil && !enabled {
+		log.Println("Collector disabled")
+		return nil
 	}
-	defer resp.Body.Close()
 
-	var result map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&result)
-
-	if accessToken, ok := result["access_token"]; ok {
-		fmt.Println("✅ Reddit API Connection Successful!")
-		fmt.Println("Access Token received:", accessToken)
-	} else {
-		fmt.Println("❌ Reddit API Connection Failed:", result)
+	config := collector.Config{
+		MaxConcurrency: 2,
+		Jitter:         30 * time.Second,
 	}
-}
 
-func testXAPI() {
-	if xBearerToken == "" {
-		var err error
-		xBearerToken, err = getXBearerToken()
-		if err != nil {
-			log.Fatal("Failed to get X Bearer Token:", err)
+	defaultInterval := 10 * time.Minute
+	if value := os.Getenv("COLLECTOR_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid COLLECTOR_INTERVAL %q", value)
 		}
+		defaultInterval = parsed
 	}
 
-	req, err := http.NewRequest(
-		"GET",
-		"https://api.twitter.com/2/tweets/search/recent?query=bitcoin",
-		nil,
-	)
-	if err != nil {
-		log.Fatal("X API request creation failed:", err)
+	watchlist := os.Getenv("COLLECTOR_WATCHLIST")
+	if watchlist == "" {
+		watchlist = "BTC,ETH,BNB,XRP,DOGE"
 	}
-
-	req.Header.Add("Authorization", "Bearer "+xBearerToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	var err error
+	config.Watchlist, err = collector.ParseWatchlist(watchlist, defaultInterval)
 	if err != nil {
-		log.Fatal("X API call failed:", err)
+		log.Fatalf("Invalid COLLECTOR_WATCHLIST: %v", err)
 	}
-	defer resp.Body.Close()
 
-	var result map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&result)
+	if value := os.Getenv("COLLECTOR_MAX_CONCURRENCY"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			log.Fatalf("Invalid COLLECTOR_MAX_CONCURRENCY %q", value)
+		}
+		config.MaxConcurrency = parsed
+	}
 
-	if _, ok := result["data"]; ok {
-		fmt.Println("✅ X (Twitter) API Connection Successful!")
-		fmt.Println("Bearer Token is valid and working!")
-	} else {
-		fmt.Println("❌ X (Twitter) API Connection Failed:", result)
+	if value := os.Getenv("COLLECTOR_JITTER"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			log.Fatalf("Invalid COLLECTOR_JITTER %q", value)
+		}
+		config.Jitter = parsed
 	}
-}
 
-func healthCheck(c *gin.Context) {
-	c.JSON(200, gin.H{
-		"status": "healthy",
-		"services": gin.H{
-			"reddit":  true,
-			"twitter": twitterEnabled,
-		},
-	})
+	return collector.New(config, sentimentService, coinService, events)
 }
 
-func getSentiment(c *gin.Context) {
-	symbol := c.Param("symbol")
-	var tweets []Tweet
-	var twitterScore float64
-	var tweetCount int
+// streamConfig reads the STREAM_* limits of the streaming endpoints
+func streamConfig() handlers.StreamConfig {
+	var config handlers.StreamConfig
 
-	// Get Twitter sentiment only if enabled
-	if twitterEnabled {
-		var err error
-		tweets, err = getTwitterPosts(symbol)
-		if err != nil {
-			log.Printf("Twitter error: %v", err)
-		} else {
-			// Calculate Twitter sentiment
-			for _, tweet := range tweets {
-				score := calculateSentiment(tweet.Text)
-				twitterScore += score
-				tweetCount++
-			}
-			if tweetCount > 0 {
-				twitterScore = twitterScore / float64(tweetCount)
-			}
+	if value := os.Getenv("STREAM_MAX_SYMBOLS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			log.Fatalf("Invalid STREAM_MAX_SYMBOLS %q", value)
 		}
+		config.MaxSymbols = parsed
 	}
 
-	// Get Reddit sentiment
-	redditPosts, err := getRedditPosts(symbol)
-	if err != nil {
-		log.Printf("Reddit error: %v", err)
+	if value := os.Getenv("STREAM_MAX_LIVE"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			log.Fatalf("Invalid STREAM_MAX_LIVE %q", value)
+		}
+		config.MaxLive = parsed
 	}
 
-	// Calculate Reddit sentiment
-	var redditScore float64
-	var redditCount int
-	for _, post := range redditPosts {
-		score := calculateSentiment(post.Title + " " + post.SelfText)
-		redditScore += score
-		redditCount++
-	}
-	if redditCount > 0 {
-		redditScore = redditScore / float64(redditCount)
+	if value := os.Getenv("STREAM_BUFFER"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			log.Fatalf("Invalid STREAM_BUFFER %q", value)
+		}
+		config.Buffer = parsed
 	}
 
-	// Calculate overall sentiment
-	totalPosts := tweetCount + redditCount
-	var overallScore float64
-	if totalPosts > 0 {
-		overallScore = (twitterScore*float64(tweetCount) + redditScore*float64(redditCount)) / float64(totalPosts)
+	if value := os.Getenv("STREAM_HEARTBEAT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid STREAM_HEARTBEAT %q", value)
+		}
+		config.Heartbeat = parsed
 	}
 
-	c.JSON(200, gin.H{
-		"symbol":        symbol,
-		"overall_score": overallScore,
-		"reddit_score":  redditScore,
-		"twitter_score": twitterScore,
-		"reddit_posts":  redditCount,
-		"tweets":        tweetCount,
-		"timestamp":     time.Now(),
-	})
-}
-
-func getTwitterPosts(symbol string) ([]Tweet, error) {
-	if xBearerToken == "" {
-		var err error
-		xBearerToken, err = getXBearerToken()
-		if err != nil {
-			return nil, err
+	if value := os.Getenv("STREAM_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid STREAM_INTERVAL %q", value)
 		}
+		config.Interval = parsed
 	}
 
-	query := url.QueryEscape(fmt.Sprintf("%s crypto -is:retweet lang:en", symbol))
-	req, err := http.NewRequest(
-		"GET",
-		fmt.Sprintf("https://api.twitter.com/2/tweets/search/recent?query=%s&max_results=100", query),
-		nil,
-	)
-	if err != nil {
-		return nil, err
-	}
+	return config
+}
 
-	req.Header.Add("Authorization", "Bearer "+xBearerToken)
+// fanoutConfig reads SENTIMENT_CONCURRENCY and SENTIMENT_SYMBOL_TIMEOUT,
+// how many symbols trending and batch requests compute at once and how
+// long each may take
+func fanoutConfig() fanout.Config {
+	var config fanout.Config
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	if value := os.Getenv("SENTIMENT_CONCURRENCY"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			log.Fatalf("Invalid SENTIMENT_CONCURRENCY %q", value)
+		}
+		config.Concurrency = parsed
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Data []Tweet `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+	if value := os.Getenv("SENTIMENT_SYMBOL_TIMEOUT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid SENTIMENT_SYMBOL_TIMEOUT %q", value)
+		}
+		config.Timeout = parsed
 	}
 
-	return result.Data, nil
+	return config
 }
 
-func getRedditPosts(symbol string) ([]RedditPost, error) {
-	clientID := os.Getenv("REDDIT_CLIENT_ID")
-	clientSecret := os.Getenv("REDDIT_CLIENT_SECRET")
+// anomalyConfig reads the ANOMALY_* settings of the anomaly detector
+func anomalyConfig() anomaly.Config {
+	var config anomaly.Config
+
+	for name, setting := range map[string]*float64{
+		"ANOMALY_ALPHA":     &config.Alpha,
+		"ANOMALY_THRESHOLD": &config.Threshold,
+	} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				log.Fatalf("Invalid %s %q", name, value)
+			}
+			*setting = parsed
+		}
+	}
 
-	// Get Reddit access token
-	authString := base64.StdEncoding.EncodeToString(
-		[]byte(fmt.Sprintf("%s:%s", clientID, clientSecret)))
+	if value := os.Getenv("ANOMALY_WARMUP"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			log.Fatalf("Invalid ANOMALY_WARMUP %q", value)
+		}
+		config.Warmup = parsed
+	}
 
-	data := url.Values{}
-	data.Set("grant_type", "client_credentials")
+	if value := os.Getenv("ANOMALY_WINDOW"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid ANOMALY_WINDOW %q", value)
+		}
+		config.Window = parsed
+	}
 
-	tokenReq, err := http.NewRequest(
-		"POST",
-		"https://www.reddit.com/api/v1/access_token",
-		strings.NewReader(data.Encode()),
-	)
-	if err != nil {
-		return nil, err
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid anomaly settings: %v", err)
 	}
+	return config
+}
 
-	tokenReq.Header.Add("Authorization", "Basic "+authString)
-	tokenReq.Header.Add("User-Agent", "CryptoSentimentBot/1.0")
-	tokenReq.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+// webhookConfig reads ALERT_WEBHOOK_TIMEOUT and ALERT_MAX_ATTEMPTS, the
+// limits of alert deliveries, and ALERT_ALLOW_PRIVATE_WEBHOOKS, which
+// permits webhooks to loopback, link-local and private addresses
+func webhookConfig() alerts.WebhookConfig {
+	var config alerts.WebhookConfig
 
-	client := &http.Client{}
-	tokenResp, err := client.Do(tokenReq)
-	if err != nil {
-		return nil, err
+	if value := os.Getenv("ALERT_ALLOW_PRIVATE_WEBHOOKS"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("Invalid ALERT_ALLOW_PRIVATE_WEBHOOKS %q", value)
+		}
+		config.AllowPrivate = parsed
 	}
-	defer tokenResp.Body.Close()
 
-	var tokenResult struct {
-		AccessToken string `json:"access_token"`
-	}
-	if err := json.NewDecoder(tokenResp.Body).Decode(&tokenResult); err != nil {
-		return nil, err
+	if value := os.Getenv("ALERT_WEBHOOK_TIMEOUT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid ALERT_WEBHOOK_TIMEOUT %q", value)
+		}
+		config.Timeout = parsed
 	}
 
-	// Use token to get posts
-	req, err := http.NewRequest(
-		"GET",
-		fmt.Sprintf("https://oauth.reddit.com/r/cryptocurrency/search.json?q=%s&limit=100&sort=new",
-			url.QueryEscape(symbol)),
-		nil,
-	)
-	if err != nil {
-		return nil, err
+	if value := os.Getenv("ALERT_MAX_ATTEMPTS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			log.Fatalf("Invalid ALERT_MAX_ATTEMPTS %q", value)
+		}
+		config.MaxAttempts = parsed
 	}
 
-	req.Header.Add("Authorization", "Bearer "+tokenResult.AccessToken)
-	req.Header.Add("User-Agent", "CryptoSentimentBot/1.0")
+	return config
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+// requestTimeout reads REQUEST_TIMEOUT, the deadline of every API request
+// including its upstream fetches
+func requestTimeout() time.Duration {
+	value := os.Getenv("REQUEST_TIMEOUT")
+	if value == "" {
+		return 20 * time.Second
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Data struct {
-			Children []struct {
-				Data RedditPost `json:"data"`
-			} `json:"children"`
-		} `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		log.Fatalf("Invalid REQUEST_TIMEOUT %q", value)
 	}
+	return timeout
+}
 
-	var posts []RedditPost
-	for _, child := range result.Data.Children {
-		posts = append(posts, child.Data)
+// sentimentCacheTTL reads SENTIMENT_CACHE_TTL, how long live sentiment
+// results are reused. Zero only shares results between concurrent
+// requests.
+func sentimentCacheTTL() time.Duration {
+	value := os.Getenv("SENTIMENT_CACHE_TTL")
+	if value == "" {
+		return time.Minute
 	}
 
-	return posts, nil
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		log.Fatalf("Invalid SENTIMENT_CACHE_TTL %q", value)
+	}
+	return ttl
 }
 
-func calculateSentiment(text string) float64 {
-	text = strings.ToLower(text)
+// databasePath is DB_PATH, defaulting to sentiment.db
+func databasePath() string {
+	if path := os.Getenv("DB_PATH"); path != "" {
+		return path
+	}
+	return "sentiment.db"
+}
 
-	positiveWords := []string{
-		"bullish", "moon", "buy", "green", "up", "good", "great",
-		"positive", "profit", "gains", "win", "winning", "success",
+// redditConfig reads the Reddit credentials, endpoints and limits.
+// REDDIT_SUBREDDITS is a comma separated list; unset limits keep their
+// defaults.
+func redditConfig() services.RedditConfig {
+	config := services.RedditConfig{
+		ClientID:     os.Getenv("REDDIT_CLIENT_ID"),
+		ClientSecret: os.Getenv("REDDIT_CLIENT_SECRET"),
+		AuthBaseURL:  os.Getenv("REDDIT_AUTH_BASE_URL"),
+		APIBaseURL:   os.Getenv("REDDIT_API_BASE_URL"),
+		TimeWindow:   strings.ToLower(os.Getenv("REDDIT_TIME_WINDOW")),
+	}
+
+	for _, subreddit := range strings.Split(os.Getenv("REDDIT_SUBREDDITS"), ",") {
+		subreddit = strings.TrimPrefix(strings.TrimSpace(subreddit), "r/")
+		if subreddit != "" {
+			config.Subreddits = append(config.Subreddits, subreddit)
+		}
 	}
 
-	negativeWords := []string{
-		"bearish", "dump", "sell", "red", "down", "bad", "crash",
-		"negative", "loss", "bear", "fail", "failing", "scam",
+	for name, limit := range map[string]*int{
+		"REDDIT_MAX_POSTS":       &config.MaxPosts,
+		"REDDIT_MAX_PAGES":       &config.MaxPages,
+		"REDDIT_COMMENT_THREADS": &config.CommentThreads,
+		"REDDIT_MAX_COMMENTS":    &config.MaxComments,
+	} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				log.Fatalf("Invalid %s %q", name, value)
+			}
+			*limit = parsed
+		}
 	}
 
-	var positiveCount, negativeCount float64
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid Reddit settings: %v", err)
+	}
+	return config
+}
 
-	words := strings.Fields(text)
-	for _, word := range words {
-		for _, pos := range positiveWords {
-			if strings.Contains(word, pos) {
-				positiveCount++
-				break
+// twitterConfig reads the Twitter credentials, endpoint and limits. An
+// empty APIKey means Twitter is not configured.
+func twitterConfig() services.TwitterConfig {
+	config := services.TwitterConfig{
+		APIKey:    strings.TrimSpace(os.Getenv("TWITTER_API_KEY")),
+		APISecret: os.Getenv("TWITTER_API_SECRET"),
+		BaseURL:   os.Getenv("TWITTER_BASE_URL"),
+	}
+
+	for name, limit := range map[string]*int{
+		"TWITTER_MAX_TWEETS":    &config.MaxTweets,
+		"TWITTER_MIN_FOLLOWERS": &config.MinFollowers,
+	} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				log.Fatalf("Invalid %s %q", name, value)
 			}
+			*limit = parsed
 		}
-		for _, neg := range negativeWords {
-			if strings.Contains(word, neg) {
-				negativeCount++
-				break
+	}
+	for name, duration := range map[string]*time.Duration{
+		"TWITTER_WINDOW":          &config.Window,
+		"TWITTER_MIN_ACCOUNT_AGE": &config.MinAccountAge,
+	} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				log.Fatalf("Invalid %s %q", name, value)
 			}
+			*duration = parsed
 		}
 	}
 
-	if positiveCount == 0 && negativeCount == 0 {
-		return 0
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid Twitter settings: %v", err)
+	}
+	return config
+}
+
+// newTwitterService returns nil and the reason when no credentials are
+// configured or the bearer token cannot be obtained, in which case Twitter
+// is reported as a disabled source.
+func newTwitterService(coins *catalog.Catalog, transport http.RoundTripper) (*services.TwitterService, string) {
+	config := twitterConfig()
+	if config.APIKey == "" {
+		log.Println("Twitter integration disabled - no API credentials provided")
+		return nil, "no API credentials provided"
+	}
+
+	twitterService, err := services.NewTwitterService(context.Background(), config, coins, transport)
+	if err != nil {
+		log.Printf("Warning: Failed to initialize X Bearer Token: %v", err)
+		return nil, "failed to obtain a bearer token"
 	}
 
-	total := positiveCount + negativeCount
-	return (positiveCount - negativeCount) / total
+	log.Println("Twitter integration enabled")
+	return twitterService, ""
 }
 
-// mmodified for twitter
-func getTrending(c *gin.Context) {
-	symbols := []string{"BTC", "ETH", "BNB", "XRP", "DOGE"}
-	var trending []gin.H
-
-	for _, symbol := range symbols {
-		var totalScore float64
-		var count int
-
-		// Get Twitter sentiment only if enabled
-		if twitterEnabled {
-			tweets, _ := getTwitterPosts(symbol)
-			for _, tweet := range tweets {
-				score := calculateSentiment(tweet.Text)
-				totalScore += score
-				count++
-			}
-		}
+// runMockUpstreams serves canned Reddit, Twitter and CoinGecko responses on
+// MOCK_UPSTREAMS_ADDR (default :9090), replaying any recorded responses in
+// MOCK_FIXTURES_DIR. Point REDDIT_AUTH_BASE_URL, REDDIT_API_BASE_URL,
+// TWITTER_BASE_URL and COINGECKO_BASE_URL at it to run without network.
+// Alert rules can deliver to its /webhook sink when
+// ALERT_ALLOW_PRIVATE_WEBHOOKS is set.
+func runMockUpstreams() {
+	addr := os.Getenv("MOCK_UPSTREAMS_ADDR")
+	if addr == "" {
+		addr = ":9090"
+	}
 
-		// Get Reddit sentiment
-		redditPosts, _ := getRedditPosts(symbol)
-		for _, post := range redditPosts {
-			score := calculateSentiment(post.Title + " " + post.SelfText)
-			totalScore += score
-			count++
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-		if count > 0 {
-			trending = append(trending, gin.H{
-				"symbol": symbol,
-				"score":  totalScore / float64(count),
-				"posts":  count,
-			})
-		}
+	server := &http.Server{
+		Addr:    addr,
+		Handler: mockupstream.NewServer(os.Getenv("MOCK_FIXTURES_DIR")),
 	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
 
-	c.JSON(200, gin.H{
-		"trending":  trending,
-		"timestamp": time.Now(),
-	})
+	log.Printf("Mock upstreams listening on %s", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Mock upstreams failed: %v", err)
+	}
 }
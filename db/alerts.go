@@ -0,0 +1,286 @@
+package db
+
+import (
+	"crypto-sentiment/internal/models"
+	"database/sql"
+	"time"
+)
+
+const alertRuleColumns = `id, symbol, condition, threshold, window_seconds, cooldown_seconds,
+        webhook_url, secret, enabled, created_at, last_fired_at`
+
+const alertEventColumns = `id, rule_id, symbol, sentiment_id, value, message, fired_at,
+        status, attempts, last_error, delivered_at`
+
+// CreateAlertRule inserts rule and sets its ID and CreatedAt
+func CreateAlertRule(rule *models.AlertRule) error {
+	if DB == nil {
+		return ErrNotInitialized
+	}
+
+	rule.CreatedAt = time.Now().UTC()
+	result, err := DB.Exec(
+		`INSERT INTO alert_rules (symbol, condition, threshold, window_seconds, cooldown_seconds,
+             webhook_url, secret, enabled, created_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rule.Symbol, rule.Condition, rule.Threshold, seconds(rule.Window), seconds(rule.Cooldown),
+		rule.WebhookURL, rule.Secret, rule.Enabled, rule.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	rule.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetAlertRule returns the rule with id, or sql.ErrNoRows
+func GetAlertRule(id int64) (*models.AlertRule, error) {
+	if DB == nil {
+		return nil, ErrNotInitialized
+	}
+
+	rule, err := scanAlertRule(DB.QueryRow(
+		`SELECT `+alertRuleColumns+` FROM alert_rules WHERE id = ?`, id,
+	))
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// GetAlertRules returns the rules for symbol, or every rule when symbol is
+// empty, oldest first
+func GetAlertRules(symbol string) ([]models.AlertRule, error) {
+	if DB == nil {
+		return nil, ErrNotInitialized
+	}
+
+	rows, err := DB.Query(
+		`SELECT `+alertRuleColumns+`
+         FROM alert_rules
+         WHERE ? = '' OR symbol = ?
+         ORDER BY id`,
+		symbol, symbol,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.AlertRule
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// UpdateAlertRule stores every editable field of rule, or returns
+// sql.ErrNoRows if it doesn't exist
+func UpdateAlertRule(rule *models.AlertRule) error {
+	if DB == nil {
+		return ErrNotInitialized
+	}
+
+	result, err := DB.Exec(
+		`UPDATE alert_rules
+         SET symbol = ?, condition = ?, threshold = ?, window_seconds = ?, cooldown_seconds = ?,
+             webhook_url = ?, secret = ?, enabled = ?
+         WHERE id = ?`,
+		rule.Symbol, rule.Condition, rule.Threshold, seconds(rule.Window), seconds(rule.Cooldown),
+		rule.WebhookURL, rule.Secret, rule.Enabled, rule.ID,
+	)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+// DeleteAlertRule removes the rule with id and its events, or returns
+// sql.ErrNoRows if it doesn't exist
+func DeleteAlertRule(id int64) error {
+	if DB == nil {
+		return ErrNotInitialized
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM alert_events WHERE rule_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM alert_rules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if err := requireRow(result); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetAlertRuleFired records when the rule with id last fired, which starts
+// its cooldown
+func SetAlertRuleFired(id int64, firedAt time.Time) error {
+	if DB == nil {
+		return ErrNotInitialized
+	}
+
+	_, err := DB.Exec(`UPDATE alert_rules SET last_fired_at = ? WHERE id = ?`, firedAt.UTC(), id)
+	return err
+}
+
+// SaveAlertEvent inserts event and sets its ID, unless an event with the
+// same dedupKey exists, in which case it returns false and stores nothing
+func SaveAlertEvent(event *models.AlertEvent, dedupKey string) (bool, error) {
+	if DB == nil {
+		return false, ErrNotInitialized
+	}
+
+	event.FiredAt = event.FiredAt.UTC()
+	result, err := DB.Exec(
+		`INSERT OR IGNORE INTO alert_events (rule_id, dedup_key, symbol, sentiment_id, value, message,
+             fired_at, status, attempts)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.RuleID, dedupKey, event.Symbol, event.SentimentID, event.Value, event.Message,
+		event.FiredAt, event.Status, event.Attempts,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil || inserted == 0 {
+		return false, err
+	}
+	event.ID, err = result.LastInsertId()
+	return true, err
+}
+
+// UpdateAlertDelivery stores the delivery status, attempts, last error and
+// delivery time of event
+func UpdateAlertDelivery(event *models.AlertEvent) error {
+	if DB == nil {
+		return ErrNotInitialized
+	}
+
+	var deliveredAt sql.NullTime
+	if event.DeliveredAt != nil {
+		deliveredAt = sql.NullTime{Time: event.DeliveredAt.UTC(), Valid: true}
+	}
+	_, err := DB.Exec(
+		`UPDATE alert_events SET status = ?, attempts = ?, last_error = ?, delivered_at = ? WHERE id = ?`,
+		event.Status, event.Attempts, event.LastError, deliveredAt, event.ID,
+	)
+	return err
+}
+
+// GetAlertEvents returns up to limit events of the rule with id, newest
+// first
+func GetAlertEvents(ruleID int64, limit int) ([]models.AlertEvent, error) {
+	if DB == nil {
+		return nil, ErrNotInitialized
+	}
+
+	return queryAlertEvents(
+		`SELECT `+alertEventColumns+`
+         FROM alert_events
+         WHERE rule_id = ?
+         ORDER BY fired_at DESC, id DESC
+         LIMIT ?`,
+		ruleID, limit,
+	)
+}
+
+// GetPendingAlertEvents returns the events whose delivery hasn't finished,
+// oldest first
+func GetPendingAlertEvents() ([]models.AlertEvent, error) {
+	if DB == nil {
+		return nil, ErrNotInitialized
+	}
+
+	return queryAlertEvents(
+		`SELECT `+alertEventColumns+`
+         FROM alert_events
+         WHERE status = ?
+         ORDER BY id`,
+		models.DeliveryPending,
+	)
+}
+
+func queryAlertEvents(query string, args ...interface{}) ([]models.AlertEvent, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.AlertEvent
+	for rows.Next() {
+		var (
+			event       models.AlertEvent
+			sentimentID sql.NullInt64
+			lastError   sql.NullString
+			deliveredAt sql.NullTime
+		)
+		if err := rows.Scan(
+			&event.ID, &event.RuleID, &event.Symbol, &sentimentID, &event.Value, &event.Message,
+			&event.FiredAt, &event.Status, &event.Attempts, &lastError, &deliveredAt,
+		); err != nil {
+			return nil, err
+		}
+		event.SentimentID = sentimentID.Int64
+		event.LastError = lastError.String
+		if deliveredAt.Valid {
+			event.DeliveredAt = &deliveredAt.Time
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func scanAlertRule(scanner rowScanner) (models.AlertRule, error) {
+	var (
+		rule            models.AlertRule
+		windowSeconds   int64
+		cooldownSeconds int64
+		lastFiredAt     sql.NullTime
+	)
+	if err := scanner.Scan(
+		&rule.ID, &rule.Symbol, &rule.Condition, &rule.Threshold, &windowSeconds, &cooldownSeconds,
+		&rule.WebhookURL, &rule.Secret, &rule.Enabled, &rule.CreatedAt, &lastFiredAt,
+	); err != nil {
+		return rule, err
+	}
+
+	rule.Window = models.Duration(time.Duration(windowSeconds) * time.Second)
+	rule.Cooldown = models.Duration(time.Duration(cooldownSeconds) * time.Second)
+	if lastFiredAt.Valid {
+		rule.LastFiredAt = &lastFiredAt.Time
+	}
+	return rule, nil
+}
+
+// seconds converts d to whole seconds for storage
+func seconds(d models.Duration) int64 {
+	return int64(time.Duration(d) / time.Second)
+}
+
+// requireRow returns sql.ErrNoRows when result affected no rows
+func requireRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
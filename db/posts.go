@@ -0,0 +1,215 @@
+package db
+
+import (
+	"crypto-sentiment/internal/models"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// PostRetention is how long the analyzed posts behind a sentiment result
+// are kept. The aggregate row itself is kept indefinitely.
+var PostRetention = 24 * time.Hour
+
+// PostFilter narrows GetPosts. Sign is "positive", "negative", "neutral"
+// or empty for all posts; Platform is a source name or empty. A Limit of 0
+// returns every matching post.
+type PostFilter struct {
+	Sign     string
+	Platform string
+	Limit    int
+	Offset   int
+}
+
+func savePosts(tx *sql.Tx, sentimentID int64, posts []models.SocialPost) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(
+		`INSERT INTO sentiment_posts
+            (sentiment_id, platform, post_id, content, score, confidence, keywords, engagement, reach, created_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, post := range posts {
+		keywords, err := json.Marshal(post.Keywords)
+		if err != nil {
+			return err
+		}
+		var createdAt sql.NullTime
+		if !post.CreatedAt.IsZero() {
+			createdAt = sql.NullTime{Time: post.CreatedAt.UTC(), Valid: true}
+		}
+		_, err = stmt.Exec(sentimentID, post.Platform, post.ID, post.Content,
+			post.Sentiment, post.Confidence, string(keywords), post.Engagement, post.Reach, createdAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prunePosts drops the posts of symbol's results computed before cutoff
+func prunePosts(tx *sql.Tx, symbol string, cutoff time.Time) error {
+	_, err := tx.Exec(
+		`DELETE FROM sentiment_posts
+         WHERE sentiment_id IN (
+             SELECT id FROM sentiment_data WHERE symbol = ? AND timestamp < ?
+         )`,
+		symbol, cutoff.UTC(),
+	)
+	return err
+}
+
+// GetPosts returns one page of the posts behind the sentiment result
+// sentimentID, strongest sentiment first, and the total number of posts
+// matching filter.
+func GetPosts(sentimentID int64, filter PostFilter) ([]models.SocialPost, int, error) {
+	if DB == nil {
+		return nil, 0, ErrNotInitialized
+	}
+
+	where := "sentiment_id = ?"
+	args := []interface{}{sentimentID}
+
+	switch filter.Sign {
+	case "":
+	case "positive":
+		where += " AND score > 0"
+	case "negative":
+		where += " AND score < 0"
+	case "neutral":
+		where += " AND score = 0"
+	default:
+		return nil, 0, fmt.Errorf("unknown sign %q", filter.Sign)
+	}
+
+	if filter.Platform != "" {
+		where += " AND platform = ?"
+		args = append(args, filter.Platform)
+	}
+
+	var total int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM sentiment_posts WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		// SQLite treats a negative limit as no limit
+		limit = -1
+	}
+
+	rows, err := DB.Query(
+		`SELECT platform, post_id, content, score, confidence, keywords, engagement, reach, created_at
+         FROM sentiment_posts
+         WHERE `+where+`
+         ORDER BY ABS(score) DESC, id
+         LIMIT ? OFFSET ?`,
+		append(args, limit, filter.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	posts := []models.SocialPost{}
+	for rows.Next() {
+		var (
+			post       models.SocialPost
+			postID     sql.NullString
+			keywords   sql.NullString
+			engagement sql.NullFloat64
+			reach      sql.NullFloat64
+			createdAt  sql.NullTime
+		)
+		err := rows.Scan(&post.Platform, &postID, &post.Content, &post.Sentiment,
+			&post.Confidence, &keywords, &engagement, &reach, &createdAt)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		post.ID = postID.String
+		post.Engagement = engagement.Float64
+		post.Reach = reach.Float64
+		post.CreatedAt = createdAt.Time
+		post.Keywords = []string{}
+		if keywords.Valid && keywords.String != "null" {
+			if err := json.Unmarshal([]byte(keywords.String), &post.Keywords); err != nil {
+				return nil, 0, err
+			}
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, total, rows.Err()
+}
+
+// GetRecentPosts returns the stored posts of every symbol created at or
+// after from, newest first. Posts without a creation time count from the
+// result they belong to. A post fetched for several results or symbols is
+// returned once.
+func GetRecentPosts(from time.Time) ([]models.SocialPost, error) {
+	if DB == nil {
+		return nil, ErrNotInitialized
+	}
+
+	rows, err := DB.Query(
+		`SELECT p.platform, p.post_id, p.content, p.score, p.confidence, p.engagement, p.reach,
+                p.created_at, d.timestamp
+         FROM sentiment_posts p
+         JOIN sentiment_data d ON d.id = p.sentiment_id
+         WHERE COALESCE(p.created_at, d.timestamp) >= ?
+         ORDER BY COALESCE(p.created_at, d.timestamp) DESC, p.id DESC`,
+		from.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	posts := []models.SocialPost{}
+	for rows.Next() {
+		var (
+			post       models.SocialPost
+			postID     sql.NullString
+			engagement sql.NullFloat64
+			reach      sql.NullFloat64
+			createdAt  sql.NullTime
+			computedAt time.Time
+		)
+		err := rows.Scan(&post.Platform, &postID, &post.Content, &post.Sentiment,
+			&post.Confidence, &engagement, &reach, &createdAt, &computedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		key := post.Platform + "/" + postID.String
+		if !postID.Valid || postID.String == "" {
+			key = post.Platform + "/" + post.Content
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		post.ID = postID.String
+		post.Engagement = engagement.Float64
+		post.Reach = reach.Float64
+		post.CreatedAt = computedAt
+		if createdAt.Valid {
+			post.CreatedAt = createdAt.Time
+		}
+		post.Keywords = []string{}
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"crypto-sentiment/internal/models"
+	"time"
+)
+
+// SavePrice inserts one price sample and sets data.ID. Samples no newer
+// than the latest one stored for the symbol, such as a cached price saved
+// again, are skipped and reported as not inserted.
+func SavePrice(data *models.PriceData) (bool, error) {
+	if DB == nil {
+		return false, ErrNotInitialized
+	}
+
+	if data.Timestamp.IsZero() {
+		data.Timestamp = time.Now()
+	}
+	data.Timestamp = data.Timestamp.UTC()
+
+	result, err := DB.Exec(
+		`INSERT INTO price_data (symbol, price, price_change_24h, market_cap, timestamp)
+         SELECT ?, ?, ?, ?, ?
+         WHERE NOT EXISTS (
+             SELECT 1 FROM price_data WHERE symbol = ? AND timestamp >= ?
+         )`,
+		data.Symbol, data.Price, data.PriceChange24h, data.MarketCap, data.Timestamp,
+		data.Symbol, data.Timestamp,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil || inserted == 0 {
+		return false, err
+	}
+	data.ID, err = result.LastInsertId()
+	return true, err
+}
+
+// GetPriceHistory averages the stored prices for symbol between from and
+// to into buckets of the given interval, aligned to multiples of interval.
+// Buckets without any rows are omitted.
+func GetPriceHistory(symbol string, from, to time.Time, interval time.Duration) ([]models.PriceHistoryPoint, error) {
+	if DB == nil {
+		return nil, ErrNotInitialized
+	}
+
+	rows, err := DB.Query(
+		`SELECT price, timestamp
+         FROM price_data
+         WHERE symbol = ? AND timestamp >= ? AND timestamp < ?
+         ORDER BY timestamp`,
+		symbol, from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.PriceHistoryPoint
+	for rows.Next() {
+		var (
+			price     float64
+			timestamp time.Time
+		)
+		if err := rows.Scan(&price, &timestamp); err != nil {
+			return nil, err
+		}
+
+		bucketStart := timestamp.Truncate(interval).UTC()
+		last := len(history) - 1
+		if last < 0 || !history[last].Timestamp.Equal(bucketStart) {
+			history = append(history, models.PriceHistoryPoint{Timestamp: bucketStart})
+			last++
+		}
+		history[last].Price += price
+		history[last].Samples++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range history {
+		history[i].Price /= float64(history[i].Samples)
+	}
+	return history, nil
+}
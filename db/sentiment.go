@@ -0,0 +1,455 @@
+package db
+
+import (
+	"crypto-sentiment/internal/models"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrNotInitialized is returned when a query runs before InitDB
+var ErrNotInitialized = errors.New("database not initialized")
+
+// SaveSentiment inserts one sentiment computation, along with the status
+// and scores of every source, and sets data.ID. Timestamps are stored
+// in UTC so that range queries compare correctly.
+func SaveSentiment(data *models.SentimentData) error {
+	if DB == nil {
+		return ErrNotInitialized
+	}
+
+	if data.Timestamp.IsZero() {
+		data.Timestamp = time.Now()
+	}
+	data.Timestamp = data.Timestamp.UTC()
+
+	var twitter sql.NullFloat64
+	if data.Twitter != nil {
+		twitter = sql.NullFloat64{Float64: *data.Twitter, Valid: true}
+	}
+
+	var aggregation models.AggregationInfo
+	if data.Aggregation != nil {
+		aggregation = *data.Aggregation
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`INSERT INTO sentiment_data
+            (symbol, score, reddit_score, twitter_score, reddit_posts, twitter_posts, total_posts, timestamp,
+             strategy, min_confidence, trim_fraction, posts_used, effective_sample_size)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		data.Symbol, data.Score, data.Reddit, twitter, data.RedditPosts, data.Tweets, data.Posts, data.Timestamp,
+		aggregation.Strategy, aggregation.MinConfidence, aggregation.TrimFraction, aggregation.Used,
+		aggregation.EffectiveSampleSize,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for name, source := range data.Sources {
+		_, err := tx.Exec(
+			`INSERT INTO sentiment_source_data
+                (sentiment_id, source, score, posts, posts_used, effective_sample_size, status, reason, latency_ms)
+             VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, name, source.Score, source.Posts, source.Used, source.EffectiveSampleSize,
+			source.Status, source.Reason, source.LatencyMS,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := savePosts(tx, id, data.AnalyzedPosts); err != nil {
+		return err
+	}
+	if err := prunePosts(tx, data.Symbol, data.Timestamp.Add(-PostRetention)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	data.ID = id
+	return nil
+}
+
+// loadSources fills data.Sources from sentiment_source_data
+func loadSources(data *models.SentimentData) error {
+	rows, err := DB.Query(
+		`SELECT `+sourceColumns+`
+         FROM sentiment_source_data
+         WHERE sentiment_id = ?`,
+		data.ID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	data.Sources = make(map[string]models.SourceSentiment)
+	for rows.Next() {
+		name, source, err := scanSource(rows)
+		if err != nil {
+			return err
+		}
+		data.Sources[name] = source
+	}
+	return rows.Err()
+}
+
+// sourceColumns is the column list scanned by scanSource
+const sourceColumns = `source, score, posts, posts_used, effective_sample_size, status, reason, latency_ms`
+
+// scanSource reads one sentiment_source_data row, followed by any extra
+// destinations
+func scanSource(scanner rowScanner, extra ...interface{}) (string, models.SourceSentiment, error) {
+	var (
+		name    string
+		source  models.SourceSentiment
+		used    sql.NullInt64
+		ess     sql.NullFloat64
+		status  sql.NullString
+		reason  sql.NullString
+		latency sql.NullInt64
+	)
+	dest := append([]interface{}{&name, &source.Score, &source.Posts, &used, &ess, &status, &reason, &latency}, extra...)
+	if err := scanner.Scan(dest...); err != nil {
+		return "", source, err
+	}
+	source.Used = int(used.Int64)
+	source.EffectiveSampleSize = ess.Float64
+	source.Reason = reason.String
+	source.LatencyMS = latency.Int64
+	// Rows stored before statuses existed were only kept on success
+	source.Status = models.SourceOK
+	if status.Valid && status.String != "" {
+		source.Status = status.String
+	}
+	return name, source, nil
+}
+
+// sentimentColumns is the column list scanned by scanSentiment
+const sentimentColumns = `id, symbol, score, reddit_score, twitter_score,
+    reddit_posts, twitter_posts, total_posts, timestamp,
+    strategy, min_confidence, trim_fraction, posts_used, effective_sample_size`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSentiment(scanner rowScanner) (models.SentimentData, error) {
+	var (
+		row          models.SentimentData
+		reddit       sql.NullFloat64
+		twitter      sql.NullFloat64
+		redditPosts  sql.NullInt64
+		twitterPosts sql.NullInt64
+		posts        sql.NullInt64
+		strategy     sql.NullString
+		minConf      sql.NullFloat64
+		trim         sql.NullFloat64
+		used         sql.NullInt64
+		ess          sql.NullFloat64
+	)
+	err := scanner.Scan(&row.ID, &row.Symbol, &row.Score, &reddit, &twitter,
+		&redditPosts, &twitterPosts, &posts, &row.Timestamp,
+		&strategy, &minConf, &trim, &used, &ess)
+	if err != nil {
+		return row, err
+	}
+
+	row.Reddit = reddit.Float64
+	row.RedditPosts = int(redditPosts.Int64)
+	row.Tweets = int(twitterPosts.Int64)
+	row.Posts = int(posts.Int64)
+	if twitter.Valid {
+		value := twitter.Float64
+		row.Twitter = &value
+	}
+	// Rows stored before aggregation strategies existed have no strategy
+	if strategy.Valid && strategy.String != "" {
+		row.Aggregation = &models.AggregationInfo{
+			Strategy:            strategy.String,
+			MinConfidence:       minConf.Float64,
+			TrimFraction:        trim.Float64,
+			Used:                int(used.Int64),
+			EffectiveSampleSize: ess.Float64,
+		}
+	}
+	return row, nil
+}
+
+// GetLatestSentiment returns the most recent row for symbol including its
+// per-source breakdown, or sql.ErrNoRows if none has been stored yet.
+func GetLatestSentiment(symbol string) (*models.SentimentData, error) {
+	if DB == nil {
+		return nil, ErrNotInitialized
+	}
+
+	row, err := scanSentiment(DB.QueryRow(
+		`SELECT `+sentimentColumns+`
+         FROM sentiment_data
+         WHERE symbol = ?
+         ORDER BY timestamp DESC
+         LIMIT 1`,
+		symbol,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadSources(&row); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// GetLatestSentiments returns the most recent row of each of symbols that
+// has one, keyed by symbol, each with its per-source breakdown. It takes
+// two queries however many symbols are given.
+func GetLatestSentiments(symbols []string) (map[string]*models.SentimentData, error) {
+	if DB == nil {
+		return nil, ErrNotInitialized
+	}
+
+	latest := make(map[string]*models.SentimentData, len(symbols))
+	if len(symbols) == 0 {
+		return latest, nil
+	}
+
+	rows, err := DB.Query(
+		`SELECT `+sentimentColumns+`
+         FROM sentiment_data AS latest
+         WHERE symbol IN (`+placeholders(len(symbols))+`)
+           AND timestamp = (SELECT MAX(timestamp) FROM sentiment_data WHERE symbol = latest.symbol)`,
+		stringArgs(symbols)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := scanSentiment(rows)
+		if err != nil {
+			return nil, err
+		}
+		// Rows stored with the same timestamp go to the last one
+		if existing, ok := latest[row.Symbol]; !ok || row.ID > existing.ID {
+			latest[row.Symbol] = &row
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(latest) == 0 {
+		return latest, nil
+	}
+
+	index := make(map[int64]*models.SentimentData, len(latest))
+	for _, row := range latest {
+		row.Sources = make(map[string]models.SourceSentiment)
+		index[row.ID] = row
+	}
+	ids := make([]interface{}, 0, len(index))
+	for id := range index {
+		ids = append(ids, id)
+	}
+	return latest, fillSources(index,
+		`SELECT `+sourceColumns+`, sentiment_id
+         FROM sentiment_source_data
+         WHERE sentiment_id IN (`+placeholders(len(ids))+`)`,
+		ids...)
+}
+
+// GetSentimentRange returns the rows for symbol with from <= timestamp < to,
+// oldest first, each with its per-source breakdown.
+func GetSentimentRange(symbol string, from, to time.Time) ([]models.SentimentData, error) {
+	ranges, err := GetSentimentRanges([]string{symbol}, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return ranges[symbol], nil
+}
+
+// GetSentimentRanges returns the rows of each of symbols with from <=
+// timestamp < to, keyed by symbol and oldest first, each with its
+// per-source breakdown. It takes two queries however many symbols are
+// given.
+func GetSentimentRanges(symbols []string, from, to time.Time) (map[string][]models.SentimentData, error) {
+	if DB == nil {
+		return nil, ErrNotInitialized
+	}
+
+	ranges := make(map[string][]models.SentimentData, len(symbols))
+	if len(symbols) == 0 {
+		return ranges, nil
+	}
+
+	filter := `symbol IN (` + placeholders(len(symbols)) + `) AND timestamp >= ? AND timestamp < ?`
+	args := append(stringArgs(symbols), from.UTC(), to.UTC())
+
+	rows, err := DB.Query(
+		`SELECT `+sentimentColumns+`
+         FROM sentiment_data
+         WHERE `+filter+`
+         ORDER BY timestamp`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := scanSentiment(rows)
+		if err != nil {
+			return nil, err
+		}
+		ranges[row.Symbol] = append(ranges[row.Symbol], row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The slices are complete, so pointers into them stay valid
+	index := make(map[int64]*models.SentimentData)
+	for _, data := range ranges {
+		for i := range data {
+			data[i].Sources = make(map[string]models.SourceSentiment)
+			index[data[i].ID] = &data[i]
+		}
+	}
+	if len(index) == 0 {
+		return ranges, nil
+	}
+	return ranges, fillSources(index,
+		`SELECT `+sourceColumns+`, sentiment_id
+         FROM sentiment_source_data
+         WHERE sentiment_id IN (SELECT id FROM sentiment_data WHERE `+filter+`)`,
+		args...)
+}
+
+// fillSources runs query, which selects sourceColumns followed by the
+// sentiment_id, and adds each source to its row in index
+func fillSources(index map[int64]*models.SentimentData, query string, args ...interface{}) error {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		name, source, err := scanSource(rows, &id)
+		if err != nil {
+			return err
+		}
+		// Rows stored between the two queries are not in index
+		if data, ok := index[id]; ok {
+			data.Sources[name] = source
+		}
+	}
+	return rows.Err()
+}
+
+// placeholders returns n comma-separated query placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
+// GetSentimentHistory averages the rows for symbol between from and to
+// into consecutive buckets of the given interval, aligned to multiples of
+// interval. A platform's score is averaged over the rows where it was
+// healthy, so failed fetches don't pull it towards zero. Buckets without
+// any rows are omitted.
+func GetSentimentHistory(symbol string, from, to time.Time, interval time.Duration) ([]models.SentimentHistoryPoint, error) {
+	rows, err := GetSentimentRange(symbol, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		history      []models.SentimentHistoryPoint
+		current      *models.SentimentHistoryPoint
+		redditSum    float64
+		redditCount  int
+		twitterSum   float64
+		twitterCount int
+	)
+
+	// flush turns the running sums of current into averages
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.Score /= float64(current.Samples)
+		if redditCount > 0 {
+			value := redditSum / float64(redditCount)
+			current.Reddit = &value
+		}
+		if twitterCount > 0 {
+			value := twitterSum / float64(twitterCount)
+			current.Twitter = &value
+		}
+		history = append(history, *current)
+		redditSum, redditCount = 0, 0
+		twitterSum, twitterCount = 0, 0
+	}
+
+	for _, row := range rows {
+		bucketStart := row.Timestamp.Truncate(interval).UTC()
+
+		if current == nil || !current.Timestamp.Equal(bucketStart) {
+			flush()
+			current = &models.SentimentHistoryPoint{Timestamp: bucketStart}
+		}
+
+		current.Score += row.Score
+		current.Posts += row.Posts
+		current.Samples++
+		if redditHealthy(&row) {
+			redditSum += row.Reddit
+			redditCount++
+		}
+		if row.Twitter != nil {
+			twitterSum += *row.Twitter
+			twitterCount++
+		}
+	}
+	flush()
+
+	return history, nil
+}
+
+// redditHealthy reports whether row's reddit score was computed from
+// fetched posts. Rows stored before sources were recorded count as healthy.
+func redditHealthy(row *models.SentimentData) bool {
+	if len(row.Sources) == 0 {
+		return true
+	}
+	source, ok := row.Sources["reddit"]
+	return ok && source.Healthy()
+}
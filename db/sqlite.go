@@ -2,15 +2,27 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var DB *sql.DB
 
+// connectionOptions let the collector, request handlers and alert delivery
+// write concurrently: WAL lets readers proceed during a write, and writers
+// wait for the lock instead of failing with "database is locked"
+const connectionOptions = "_busy_timeout=5000&_journal_mode=WAL"
+
 func InitDB(dbPath string) error {
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+
 	var err error
-	DB, err = sql.Open("sqlite3", dbPath)
+	DB, err = sql.Open("sqlite3", dbPath+separator+connectionOptions)
 	if err != nil {
 		return err
 	}
@@ -24,6 +36,31 @@ func InitDB(dbPath string) error {
 	return nil
 }
 
+// OpenReadOnly opens an existing database without creating the file or
+// its schema, for inspecting a database another process owns
+func OpenReadOnly(dbPath string) error {
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+
+	var err error
+	DB, err = sql.Open("sqlite3", "file:"+dbPath+separator+"mode=ro&_busy_timeout=5000")
+	return err
+}
+
+// Ping checks that the database is open and its schema readable
+func Ping() error {
+	if DB == nil {
+		return ErrNotInitialized
+	}
+	if err := DB.Ping(); err != nil {
+		return err
+	}
+	var count int
+	return DB.QueryRow("SELECT COUNT(*) FROM sentiment_data").Scan(&count)
+}
+
 func createTables() error {
 	sentimentTable := `
     CREATE TABLE IF NOT EXISTS sentiment_data (
@@ -34,12 +71,177 @@ func createTables() error {
         twitter_score REAL,
         total_posts INTEGER,
         timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
-    );`
+    );
+    CREATE INDEX IF NOT EXISTS idx_sentiment_data_symbol_timestamp
+        ON sentiment_data (symbol, timestamp);`
 
 	_, err := DB.Exec(sentimentTable)
 	if err != nil {
 		return err
 	}
 
+	// Columns added after the initial schema
+	if err := addColumnIfMissing("sentiment_data", "reddit_posts", "INTEGER"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("sentiment_data", "twitter_posts", "INTEGER"); err != nil {
+		return err
+	}
+	for column, columnType := range map[string]string{
+		"strategy":              "TEXT",
+		"min_confidence":        "REAL",
+		"trim_fraction":         "REAL",
+		"posts_used":            "INTEGER",
+		"effective_sample_size": "REAL",
+	} {
+		if err := addColumnIfMissing("sentiment_data", column, columnType); err != nil {
+			return err
+		}
+	}
+
+	sourceTable := `
+    CREATE TABLE IF NOT EXISTS sentiment_source_data (
+        sentiment_id INTEGER NOT NULL REFERENCES sentiment_data (id),
+        source TEXT NOT NULL,
+        score REAL NOT NULL,
+        posts INTEGER NOT NULL,
+        PRIMARY KEY (sentiment_id, source)
+    );`
+
+	_, err = DB.Exec(sourceTable)
+	if err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("sentiment_source_data", "posts_used", "INTEGER"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("sentiment_source_data", "effective_sample_size", "REAL"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("sentiment_source_data", "status", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("sentiment_source_data", "reason", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("sentiment_source_data", "latency_ms", "INTEGER"); err != nil {
+		return err
+	}
+
+	postsTable := `
+    CREATE TABLE IF NOT EXISTS sentiment_posts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        sentiment_id INTEGER NOT NULL REFERENCES sentiment_data (id),
+        platform TEXT NOT NULL,
+        post_id TEXT,
+        content TEXT NOT NULL,
+        score REAL NOT NULL,
+        confidence REAL NOT NULL,
+        keywords TEXT,
+        created_at DATETIME
+    );
+    CREATE INDEX IF NOT EXISTS idx_sentiment_posts_sentiment_id
+        ON sentiment_posts (sentiment_id);`
+
+	_, err = DB.Exec(postsTable)
+	if err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("sentiment_posts", "engagement", "REAL"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("sentiment_posts", "reach", "REAL"); err != nil {
+		return err
+	}
+
+	priceTable := `
+    CREATE TABLE IF NOT EXISTS price_data (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        symbol TEXT NOT NULL,
+        price REAL NOT NULL,
+        price_change_24h REAL,
+        market_cap REAL,
+        timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_price_data_symbol_timestamp
+        ON price_data (symbol, timestamp);`
+
+	_, err = DB.Exec(priceTable)
+	if err != nil {
+		return err
+	}
+
+	alertTables := `
+    CREATE TABLE IF NOT EXISTS alert_rules (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        symbol TEXT NOT NULL,
+        condition TEXT NOT NULL,
+        threshold REAL NOT NULL,
+        window_seconds INTEGER NOT NULL DEFAULT 0,
+        cooldown_seconds INTEGER NOT NULL DEFAULT 0,
+        webhook_url TEXT NOT NULL,
+        secret TEXT NOT NULL,
+        enabled INTEGER NOT NULL DEFAULT 1,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        last_fired_at DATETIME
+    );
+    CREATE INDEX IF NOT EXISTS idx_alert_rules_symbol
+        ON alert_rules (symbol);
+    CREATE TABLE IF NOT EXISTS alert_events (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        rule_id INTEGER NOT NULL REFERENCES alert_rules (id),
+        dedup_key TEXT NOT NULL UNIQUE,
+        symbol TEXT NOT NULL,
+        sentiment_id INTEGER,
+        value REAL NOT NULL,
+        message TEXT NOT NULL,
+        fired_at DATETIME NOT NULL,
+        status TEXT NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        last_error TEXT,
+        delivered_at DATETIME
+    );
+    CREATE INDEX IF NOT EXISTS idx_alert_events_rule_id
+        ON alert_events (rule_id, fired_at);`
+
+	_, err = DB.Exec(alertTables)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// addColumnIfMissing upgrades databases created by an older schema, since
+// CREATE TABLE IF NOT EXISTS leaves existing tables untouched.
+func addColumnIfMissing(table, column, columnType string) error {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			ctype      string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, columnType))
+	return err
+}
@@ -1,4 +1,5 @@
 let twitterEnabled = false;
+let liveStream = null;
 
 // Check if Twitter is enabled on page load
 async function checkTwitterStatus() {
@@ -33,26 +34,45 @@ async function analyzeSentiment() {
         if (!response.ok) throw new Error('Failed to fetch sentiment data');
         const data = await response.json();
 
-        // Display result
-        resultDiv.innerHTML = `
-            <div class="bg-gray-50 p-4 rounded">
-                <div class="text-xl font-bold mb-4">
-                    ${data.symbol.toUpperCase()}: ${(data.overall_score * 100).toFixed(1)}% 
-                    ${data.overall_score > 0.1 ? '📈 Bullish' : data.overall_score < -0.1 ? '📉 Bearish' : '↔️ Neutral'}
-                </div>
-                <div class="mb-2">Reddit Score: ${(data.reddit_score * 100).toFixed(1)}% (${data.reddit_posts} posts)</div>
-                ${
-                    twitterEnabled
-                        ? `<div>Twitter Score: ${(data.twitter_score * 100).toFixed(1)}% (${data.tweets} tweets)</div>`
-                        : ''
-                }
-            </div>
-        `;
+        renderSentiment(data.symbol, data.overall_score, data);
+        followSymbol(data.symbol);
     } catch (error) {
         console.error('Error fetching sentiment data:', error);
         resultDiv.innerHTML = `<div class="text-red-500">Error fetching data. Please try again.</div>`;
     }
 }
 
+// Display a sentiment result; score is passed separately because stream
+// updates carry it as "score" rather than "overall_score"
+function renderSentiment(symbol, score, data) {
+    document.getElementById('result').innerHTML = `
+        <div class="bg-gray-50 p-4 rounded">
+            <div class="text-xl font-bold mb-4">
+                ${symbol.toUpperCase()}: ${(score * 100).toFixed(1)}% 
+                ${score > 0.1 ? '📈 Bullish' : score < -0.1 ? '📉 Bearish' : '↔️ Neutral'}
+            </div>
+            <div class="mb-2">Reddit Score: ${(data.reddit_score * 100).toFixed(1)}% (${data.reddit_posts} posts)</div>
+            ${
+                twitterEnabled && data.twitter_score !== undefined
+                    ? `<div>Twitter Score: ${(data.twitter_score * 100).toFixed(1)}% (${data.tweets} tweets)</div>`
+                    : ''
+            }
+            <div class="text-sm text-gray-500 mt-2">Updated ${new Date(data.timestamp).toLocaleTimeString()}</div>
+        </div>
+    `;
+}
+
+// Keep the displayed symbol up to date from the sentiment stream
+function followSymbol(symbol) {
+    if (liveStream) liveStream.close();
+    if (!window.EventSource) return;
+
+    liveStream = new EventSource(`/api/v1/stream?symbols=${encodeURIComponent(symbol)}`);
+    liveStream.addEventListener('sentiment', (message) => {
+        const update = JSON.parse(message.data).sentiment;
+        renderSentiment(update.symbol, update.score, update);
+    });
+}
+
 // Check Twitter status when page loads
 document.addEventListener('DOMContentLoaded', checkTwitterStatus);
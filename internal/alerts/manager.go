@@ -0,0 +1,244 @@
+package alerts
+
+import (
+	"context"
+	"crypto-sentiment/db"
+	"crypto-sentiment/internal/hub"
+	"crypto-sentiment/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// eventBuffer is how many sentiment results may wait for evaluation
+	eventBuffer = 64
+	// queueSize is how many deliveries may wait for the worker. Events that
+	// don't fit stay pending and are picked up by the next sweep.
+	queueSize = 256
+	// sweepInterval is how often pending deliveries are requeued
+	sweepInterval = time.Minute
+)
+
+// Manager evaluates the alert rules against every sentiment result
+// published on the hub and delivers the alerts that fire. Events are
+// stored before they are delivered, so deliveries interrupted by a restart
+// are resumed.
+type Manager struct {
+	events  *hub.Hub
+	webhook *Webhook
+	queue   chan models.AlertEvent
+
+	mutex sync.Mutex
+	// queued holds the IDs of the events in the queue or being delivered
+	queued map[int64]bool
+}
+
+func NewManager(events *hub.Hub, webhook *Webhook) *Manager {
+	return &Manager{
+		events:  events,
+		webhook: webhook,
+		queue:   make(chan models.AlertEvent, queueSize),
+		queued:  make(map[int64]bool),
+	}
+}
+
+// Run evaluates sentiment results and delivers alerts until ctx is done
+func (m *Manager) Run(ctx context.Context) {
+	sub := m.events.SubscribeAll(eventBuffer)
+	defer sub.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.deliverQueued(ctx)
+	}()
+	defer wg.Wait()
+
+	m.sweep()
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-sub.Events():
+			if event.Type == hub.EventSentiment {
+				m.Check(event.Sentiment)
+			}
+		case <-ticker.C:
+			m.sweep()
+		}
+	}
+}
+
+// Check evaluates the enabled rules for data's symbol and queues an alert
+// for each one that fires, unless the rule is cooling down or already
+// fired for this result
+func (m *Manager) Check(data *models.SentimentData) {
+	rules, err := db.GetAlertRules(data.Symbol)
+	if err != nil {
+		log.Printf("Alerts: loading rules for %s failed: %v", data.Symbol, err)
+		return
+	}
+
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		if rule.LastFiredAt != nil && time.Since(*rule.LastFiredAt) < time.Duration(rule.Cooldown) {
+			continue
+		}
+
+		var history []models.SentimentData
+		if needsHistory(rule.Condition) {
+			history, err = db.GetSentimentRange(data.Symbol, data.Timestamp.Add(-time.Duration(rule.Window)), data.Timestamp)
+			if err != nil {
+				log.Printf("Alerts: loading history of %s failed: %v", data.Symbol, err)
+				continue
+			}
+		}
+
+		fired, value, message := Evaluate(rule, data, history)
+		if !fired {
+			continue
+		}
+
+		event := models.AlertEvent{
+			RuleID:      rule.ID,
+			Symbol:      data.Symbol,
+			SentimentID: data.ID,
+			Value:       value,
+			Message:     message,
+			FiredAt:     time.Now(),
+			Status:      models.DeliveryPending,
+		}
+		// The same result may be published more than once, e.g. by the
+		// collector and by a stream refresh
+		dedupKey := fmt.Sprintf("%d/%s", rule.ID, data.Timestamp.UTC().Format(time.RFC3339Nano))
+		inserted, err := db.SaveAlertEvent(&event, dedupKey)
+		if err != nil {
+			log.Printf("Alerts: saving event of rule %d failed: %v", rule.ID, err)
+			continue
+		}
+		if !inserted {
+			continue
+		}
+		if err := db.SetAlertRuleFired(rule.ID, event.FiredAt); err != nil {
+			log.Printf("Alerts: recording firing of rule %d failed: %v", rule.ID, err)
+		}
+
+		log.Printf("Alert %d fired: %s", event.ID, message)
+		m.enqueue(event)
+	}
+}
+
+// CheckTarget rejects webhook URLs the webhook is not allowed to deliver to
+func (m *Manager) CheckTarget(ctx context.Context, target string) error {
+	return m.webhook.CheckTarget(ctx, target)
+}
+
+// Test sends a test payload for rule in a single attempt, without
+// recording an event
+func (m *Manager) Test(ctx context.Context, rule models.AlertRule) error {
+	return m.webhook.Send(ctx, rule.WebhookURL, rule.Secret, Payload{
+		RuleID:    rule.ID,
+		Symbol:    rule.Symbol,
+		Condition: rule.Condition,
+		Threshold: rule.Threshold,
+		Message:   fmt.Sprintf("Test alert for rule %d on %s", rule.ID, rule.Symbol),
+		FiredAt:   time.Now().UTC(),
+		Test:      true,
+	})
+}
+
+// sweep queues the pending events that aren't queued yet
+func (m *Manager) sweep() {
+	events, err := db.GetPendingAlertEvents()
+	if err != nil {
+		log.Printf("Alerts: loading pending events failed: %v", err)
+		return
+	}
+	for _, event := range events {
+		m.enqueue(event)
+	}
+}
+
+func (m *Manager) enqueue(event models.AlertEvent) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.queued[event.ID] {
+		return
+	}
+	select {
+	case m.queue <- event:
+		m.queued[event.ID] = true
+	default:
+		log.Printf("Alerts: delivery queue full, event %d deferred", event.ID)
+	}
+}
+
+// deliverQueued delivers queued events one at a time until ctx is done
+func (m *Manager) deliverQueued(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-m.queue:
+			m.deliver(ctx, event)
+
+			m.mutex.Lock()
+			delete(m.queued, event.ID)
+			m.mutex.Unlock()
+		}
+	}
+}
+
+// deliver sends event to its rule's webhook and records the outcome. A
+// delivery cut short by shutdown stays pending.
+func (m *Manager) deliver(ctx context.Context, event models.AlertEvent) {
+	rule, err := db.GetAlertRule(event.RuleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Deleted along with its events
+		return
+	}
+	if err != nil {
+		log.Printf("Alerts: loading rule %d failed: %v", event.RuleID, err)
+		return
+	}
+
+	attempts, err := m.webhook.Deliver(ctx, rule.WebhookURL, rule.Secret, Payload{
+		EventID:     event.ID,
+		RuleID:      rule.ID,
+		Symbol:      event.Symbol,
+		Condition:   rule.Condition,
+		Threshold:   rule.Threshold,
+		Value:       event.Value,
+		Message:     event.Message,
+		SentimentID: event.SentimentID,
+		FiredAt:     event.FiredAt,
+	})
+	event.Attempts += attempts
+	switch {
+	case err == nil:
+		now := time.Now()
+		event.Status = models.DeliveryDelivered
+		event.LastError = ""
+		event.DeliveredAt = &now
+	case ctx.Err() != nil:
+		event.LastError = err.Error()
+	default:
+		log.Printf("Alerts: delivering event %d failed after %d attempts: %v", event.ID, event.Attempts, err)
+		event.Status = models.DeliveryFailed
+		event.LastError = err.Error()
+	}
+
+	if err := db.UpdateAlertDelivery(&event); err != nil {
+		log.Printf("Alerts: recording delivery of event %d failed: %v", event.ID, err)
+	}
+}
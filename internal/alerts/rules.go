@@ -0,0 +1,120 @@
+package alerts
+
+import (
+	"crypto-sentiment/internal/models"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// minWindow is the shortest window of the conditions that compare against
+// history; windows are stored in whole seconds
+const minWindow = time.Minute
+
+// Validate normalizes rule and checks that it can be evaluated and
+// delivered
+func Validate(rule *models.AlertRule) error {
+	rule.Symbol = strings.ToUpper(strings.TrimSpace(rule.Symbol))
+	rule.Condition = strings.ToLower(strings.TrimSpace(rule.Condition))
+	if rule.Symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+
+	switch rule.Condition {
+	case models.ConditionScoreBelow, models.ConditionScoreAbove:
+		if rule.Threshold < -1 || rule.Threshold > 1 {
+			return fmt.Errorf("threshold must be between -1 and 1 for %s", rule.Condition)
+		}
+		rule.Window = 0
+	case models.ConditionChangeAbove:
+		if rule.Threshold <= 0 || rule.Threshold > 2 {
+			return fmt.Errorf("threshold must be above 0 and at most 2 for %s", rule.Condition)
+		}
+	case models.ConditionVolumeSpike:
+		if rule.Threshold <= 1 {
+			return fmt.Errorf("threshold must be above 1 for %s", rule.Condition)
+		}
+	case "":
+		return fmt.Errorf("condition is required")
+	default:
+		return fmt.Errorf("unknown condition %q", rule.Condition)
+	}
+
+	if needsHistory(rule.Condition) && time.Duration(rule.Window) < minWindow {
+		return fmt.Errorf("window must be at least %s for %s", minWindow, rule.Condition)
+	}
+	if rule.Cooldown < 0 {
+		return fmt.Errorf("cooldown must not be negative")
+	}
+
+	target, err := url.Parse(rule.WebhookURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("webhook_url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// needsHistory reports whether condition compares against earlier results
+func needsHistory(condition string) bool {
+	return condition == models.ConditionChangeAbove || condition == models.ConditionVolumeSpike
+}
+
+// Evaluate reports whether data meets the condition of rule, along with
+// the measured value and a description. history holds the stored results
+// within the rule's window before data, oldest first; without it the
+// history conditions never fire. Results in which a source failed or was
+// degraded are left out of the history, and never trigger volume_spike,
+// since their post counts are short.
+func Evaluate(rule models.AlertRule, data *models.SentimentData, history []models.SentimentData) (bool, float64, string) {
+	history = complete(history)
+
+	switch rule.Condition {
+	case models.ConditionScoreBelow:
+		return data.Score < rule.Threshold, data.Score,
+			fmt.Sprintf("%s sentiment score %.2f is below %.2f", data.Symbol, data.Score, rule.Threshold)
+
+	case models.ConditionScoreAbove:
+		return data.Score > rule.Threshold, data.Score,
+			fmt.Sprintf("%s sentiment score %.2f is above %.2f", data.Symbol, data.Score, rule.Threshold)
+
+	case models.ConditionChangeAbove:
+		if len(history) == 0 {
+			return false, 0, ""
+		}
+		change := data.Score - history[0].Score
+		return math.Abs(change) > rule.Threshold, change,
+			fmt.Sprintf("%s sentiment score changed by %+.2f within %s, more than %.2f",
+				data.Symbol, change, time.Duration(rule.Window), rule.Threshold)
+
+	case models.ConditionVolumeSpike:
+		if len(history) == 0 || !data.Complete() {
+			return false, 0, ""
+		}
+		total := 0
+		for _, row := range history {
+			total += row.Posts
+		}
+		baseline := float64(total) / float64(len(history))
+		if baseline == 0 {
+			return false, 0, ""
+		}
+		ratio := float64(data.Posts) / baseline
+		return ratio >= rule.Threshold, ratio,
+			fmt.Sprintf("%s post volume %d is %.1fx its %s average of %.0f",
+				data.Symbol, data.Posts, ratio, time.Duration(rule.Window), baseline)
+	}
+	return false, 0, ""
+}
+
+// complete returns the rows in which every source succeeded or was disabled
+func complete(rows []models.SentimentData) []models.SentimentData {
+	var kept []models.SentimentData
+	for _, row := range rows {
+		if row.Complete() {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,257 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Headers of every webhook request. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), where
+// timestamp is the X-Alert-Timestamp value, so receivers can check both
+// the sender and the age of a request. Retries of one event carry the same
+// X-Alert-Event, which receivers can use to drop duplicates.
+const (
+	EventHeader     = "X-Alert-Event"
+	TimestampHeader = "X-Alert-Timestamp"
+	SignatureHeader = "X-Alert-Signature"
+)
+
+// Defaults for the WebhookConfig limits
+const (
+	defaultWebhookTimeout = 10 * time.Second
+	defaultMaxAttempts    = 4
+	defaultBackoff        = time.Second
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// WebhookConfig sets how deliveries are attempted. Zero values take their
+// defaults.
+type WebhookConfig struct {
+	// Timeout bounds each attempt
+	Timeout time.Duration
+	// MaxAttempts is how often a delivery is tried before it is given up
+	MaxAttempts int
+	// Backoff is the wait before the first retry; it doubles with each
+	// retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// AllowPrivate permits webhooks to loopback, link-local and private
+	// addresses, which are refused by default so that rules can't be used
+	// to reach internal services
+	AllowPrivate bool
+}
+
+// ErrPrivateTarget is returned for webhooks to addresses that are not
+// allowed
+var ErrPrivateTarget = errors.New("webhook_url must not point to a loopback, link-local or private address")
+
+// Payload is the JSON body of a webhook request
+type Payload struct {
+	EventID     int64     `json:"event_id"`
+	RuleID      int64     `json:"rule_id"`
+	Symbol      string    `json:"symbol"`
+	Condition   string    `json:"condition"`
+	Threshold   float64   `json:"threshold"`
+	Value       float64   `json:"value"`
+	Message     string    `json:"message"`
+	SentimentID int64     `json:"sentiment_id,omitempty"`
+	FiredAt     time.Time `json:"fired_at"`
+	// Test is set for deliveries requested through the API rather than
+	// fired by the rule
+	Test bool `json:"test,omitempty"`
+}
+
+// Webhook posts signed payloads to rule endpoints
+type Webhook struct {
+	client *http.Client
+	config WebhookConfig
+}
+
+func NewWebhook(config WebhookConfig) *Webhook {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultWebhookTimeout
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultBackoff
+	}
+	if config.MaxBackoff < config.Backoff {
+		config.MaxBackoff = defaultMaxBackoff
+	}
+
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	if !config.AllowPrivate {
+		// Checked on the address actually dialed, so that a host resolving
+		// differently after CheckTarget, or a redirect, can't get through
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || private(ip) {
+				return ErrPrivateTarget
+			}
+			return nil
+		}
+	}
+
+	return &Webhook{
+		client: &http.Client{
+			Timeout: config.Timeout,
+			// No proxy, since the dialer would only see the proxy's address
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: config.Timeout,
+				MaxIdleConnsPerHost: 2,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		config: config,
+	}
+}
+
+// CheckTarget resolves the host of target and rejects it when any of its
+// addresses is private and AllowPrivate is off
+func (w *Webhook) CheckTarget(ctx context.Context, target string) error {
+	if w.config.AllowPrivate {
+		return nil
+	}
+
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if private(ip) {
+			return ErrPrivateTarget
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("webhook_url host %s does not resolve", host)
+	}
+	for _, addr := range addrs {
+		if private(addr.IP) {
+			return ErrPrivateTarget
+		}
+	}
+	return nil
+}
+
+// private reports whether ip is loopback, link-local, private, unspecified
+// or multicast rather than a public unicast address
+func private(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// deliveryError is a failed attempt. Retry is false for responses that
+// won't change when the request is repeated.
+type deliveryError struct {
+	err        error
+	retry      bool
+	retryAfter time.Duration
+}
+
+func (e *deliveryError) Error() string {
+	return e.err.Error()
+}
+
+// Deliver sends payload until an attempt succeeds, a response rules out
+// retrying or MaxAttempts is reached, waiting between attempts with
+// exponential backoff. It returns the number of attempts made and the
+// error of the last one. Deliver stops early when ctx is done.
+func (w *Webhook) Deliver(ctx context.Context, target, secret string, payload Payload) (int, error) {
+	backoff := w.config.Backoff
+	for attempt := 1; ; attempt++ {
+		err := w.Send(ctx, target, secret, payload)
+		if err == nil {
+			return attempt, nil
+		}
+
+		failure, ok := err.(*deliveryError)
+		if !ok || !failure.retry || attempt >= w.config.MaxAttempts || ctx.Err() != nil {
+			return attempt, err
+		}
+
+		wait := backoff
+		if failure.retryAfter > wait {
+			wait = min(failure.retryAfter, w.config.MaxBackoff)
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, w.config.MaxBackoff)
+	}
+}
+
+// Send makes a single delivery attempt. Any 2xx response is a success.
+func (w *Webhook) Send(ctx context.Context, target, secret string, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "crypto-sentiment-alerts")
+	req.Header.Set(EventHeader, strconv.FormatInt(payload.EventID, 10))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return &deliveryError{err: err, retry: !errors.Is(err, ErrPrivateTarget)}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	failure := &deliveryError{
+		err: fmt.Errorf("webhook returned %s", resp.Status),
+		retry: resp.StatusCode >= 500 ||
+			resp.StatusCode == http.StatusTooManyRequests ||
+			resp.StatusCode == http.StatusRequestTimeout,
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		failure.retryAfter = time.Duration(seconds) * time.Second
+	}
+	return failure
+}
+
+// Sign returns the X-Alert-Signature value of body sent at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
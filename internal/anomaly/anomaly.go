@@ -0,0 +1,187 @@
+package anomaly
+
+import (
+	"crypto-sentiment/internal/models"
+	"crypto-sentiment/internal/stats"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Metrics checked for each stored result
+const (
+	MetricScore = "score"
+	MetricPosts = "posts"
+)
+
+// Defaults for the Config settings
+const (
+	defaultAlpha     = 0.1
+	defaultThreshold = 3
+	defaultWarmup    = 10
+	defaultWindow    = 7 * 24 * time.Hour
+)
+
+// Floors of the standard deviation, so that a quiet series doesn't make
+// every small move an outlier. Post counts use a fraction of their mean.
+const (
+	minScoreStdDev    = 0.05
+	minPostsStdDev    = 1
+	minPostsStdDevPct = 0.1
+)
+
+// Config sets how the baseline adapts and what counts as an outlier. Zero
+// values take their defaults.
+type Config struct {
+	// Alpha is the weight of each new result in the EWMA baseline
+	Alpha float64
+	// Threshold is the absolute z-score from which a result is an anomaly
+	Threshold float64
+	// Warmup is how many results build the baseline before any is flagged
+	Warmup int
+	// Window is how much stored history is analyzed
+	Window time.Duration
+}
+
+// Validate fills in the defaults and checks the bounds
+func (c *Config) Validate() error {
+	if c.Alpha == 0 {
+		c.Alpha = defaultAlpha
+	}
+	if c.Threshold == 0 {
+		c.Threshold = defaultThreshold
+	}
+	if c.Warmup == 0 {
+		c.Warmup = defaultWarmup
+	}
+	if c.Window == 0 {
+		c.Window = defaultWindow
+	}
+
+	if c.Alpha <= 0 || c.Alpha >= 1 {
+		return fmt.Errorf("alpha must be in (0, 1)")
+	}
+	if c.Threshold <= 0 {
+		return fmt.Errorf("threshold must be positive")
+	}
+	if c.Warmup < 2 {
+		return fmt.Errorf("warmup must be at least 2 samples")
+	}
+	if c.Window <= 0 {
+		return fmt.Errorf("window must be positive")
+	}
+	return nil
+}
+
+// Deviation compares a value with the baseline built from the results
+// before it
+type Deviation struct {
+	Value    float64 `json:"value"`
+	Baseline float64 `json:"baseline"`
+	StdDev   float64 `json:"std_dev"`
+	ZScore   float64 `json:"z_score"`
+}
+
+// Anomaly is a stored result whose metric was an outlier
+type Anomaly struct {
+	Symbol      string    `json:"symbol"`
+	Metric      string    `json:"metric"`
+	SentimentID int64     `json:"sentiment_id,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	Deviation
+}
+
+// Report is the analysis of one symbol's history. Score and Posts describe
+// the latest result and are nil until the baseline is warmed up, or when
+// the latest result is Incomplete. Deviation is the larger of their
+// absolute z-scores. Samples counts the complete results analyzed.
+type Report struct {
+	Symbol     string     `json:"symbol"`
+	Samples    int        `json:"samples"`
+	Timestamp  time.Time  `json:"timestamp,omitempty"`
+	Incomplete bool       `json:"incomplete,omitempty"`
+	Score      *Deviation `json:"score,omitempty"`
+	Posts      *Deviation `json:"posts,omitempty"`
+	Deviation  *float64   `json:"deviation"`
+	Anomalous  bool       `json:"anomalous"`
+	// Anomalies are the outliers within the history, oldest first
+	Anomalies []Anomaly `json:"-"`
+}
+
+// Analyze runs the baseline over rows, oldest first, and flags every
+// result whose score or post count is Threshold standard deviations or
+// more from the baseline of the results before it. Results in which a
+// source failed or was degraded are left out, since their missing posts
+// would skew the baseline and read as outliers.
+func Analyze(symbol string, rows []models.SentimentData, config Config) Report {
+	report := Report{Symbol: symbol}
+	score := stats.EWMA{Alpha: config.Alpha}
+	posts := stats.EWMA{Alpha: config.Alpha}
+
+	for i, row := range rows {
+		latest := i == len(rows)-1
+		if !row.Complete() {
+			if latest {
+				report.Timestamp = row.Timestamp
+				report.Incomplete = true
+			}
+			continue
+		}
+		report.Samples++
+		scoreDeviation, scoreOK := deviation(&score, row.Score, minScoreStdDev, config.Warmup)
+		postsFloor := math.Max(minPostsStdDev, minPostsStdDevPct*posts.Mean)
+		postsDeviation, postsOK := deviation(&posts, float64(row.Posts), postsFloor, config.Warmup)
+
+		for _, metric := range []struct {
+			name      string
+			deviation Deviation
+			ok        bool
+		}{
+			{MetricScore, scoreDeviation, scoreOK},
+			{MetricPosts, postsDeviation, postsOK},
+		} {
+			if metric.ok && math.Abs(metric.deviation.ZScore) >= config.Threshold {
+				report.Anomalies = append(report.Anomalies, Anomaly{
+					Symbol:      symbol,
+					Metric:      metric.name,
+					SentimentID: row.ID,
+					Timestamp:   row.Timestamp,
+					Deviation:   metric.deviation,
+				})
+				if latest {
+					report.Anomalous = true
+				}
+			}
+		}
+
+		if latest {
+			report.Timestamp = row.Timestamp
+			if scoreOK && postsOK {
+				report.Score = &scoreDeviation
+				report.Posts = &postsDeviation
+				largest := math.Max(math.Abs(scoreDeviation.ZScore), math.Abs(postsDeviation.ZScore))
+				report.Deviation = &largest
+			}
+		}
+
+		score.Add(row.Score)
+		posts.Add(float64(row.Posts))
+	}
+	return report
+}
+
+// deviation compares value with the baseline, which must hold at least
+// warmup samples
+func deviation(baseline *stats.EWMA, value, minStdDev float64, warmup int) (Deviation, bool) {
+	if baseline.Count < warmup {
+		return Deviation{}, false
+	}
+
+	z, ok := baseline.ZScore(value, minStdDev)
+	return Deviation{
+		Value:    value,
+		Baseline: baseline.Mean,
+		StdDev:   baseline.StdDev(),
+		ZScore:   z,
+	}, ok
+}
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Defaults for the Config limits
+const (
+	defaultMaxEntries  = 1000
+	defaultLoadTimeout = 30 * time.Second
+)
+
+// Config sets how long entries live and how many are kept. Zero values
+// take their defaults; a zero StaleTTL disables stale-while-revalidate.
+type Config struct {
+	// TTL is how long an entry is served as fresh
+	TTL time.Duration
+	// StaleTTL is how long after TTL an entry is still served while it is
+	// reloaded in the background
+	StaleTTL time.Duration
+	// MaxEntries bounds the cache; the least recently used entry is
+	// evicted to make room
+	MaxEntries int
+	// LoadTimeout bounds each load started without a deadline. Loads are
+	// not cancelled with the caller that started them, so that the others
+	// waiting on the same key still get the value.
+	LoadTimeout time.Duration
+}
+
+// Stats counts what the cache did since it was created
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	StaleHits int64 `json:"stale_hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+}
+
+// Lookup tells where a value returned by GetOrLoad came from
+type Lookup struct {
+	// Cached is false when the value was loaded for this call, or for a
+	// concurrent one it waited on
+	Cached bool `json:"cached"`
+	// Stale is set for a cached value past its TTL that is being reloaded
+	Stale bool `json:"stale"`
+}
+
+// Cache is a size-bounded TTL cache that is safe for concurrent use.
+// Concurrent loads of the same key share a single call.
+type Cache[K comparable, V any] struct {
+	config Config
+
+	mutex   sync.Mutex
+	entries map[K]*list.Element
+	// recency orders the entries from most to least recently used
+	recency *list.List
+	flights map[K]*flight[V]
+	stats   Stats
+}
+
+type entry[K comparable, V any] struct {
+	key    K
+	value  V
+	stored time.Time
+}
+
+// flight is a load in progress; done is closed once value and err are set
+type flight[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// New creates an empty cache
+func New[K comparable, V any](config Config) *Cache[K, V] {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = defaultMaxEntries
+	}
+	if config.LoadTimeout <= 0 {
+		config.LoadTimeout = defaultLoadTimeout
+	}
+
+	return &Cache[K, V]{
+		config:  config,
+		entries: make(map[K]*list.Element),
+		recency: list.New(),
+		flights: make(map[K]*flight[V]),
+	}
+}
+
+// Get returns the value stored under key if it is still fresh
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, ok := c.lookup(key); ok && time.Since(e.stored) < c.config.TTL {
+		c.stats.Hits++
+		return e.value, true
+	}
+	c.stats.Misses++
+	var zero V
+	return zero, false
+}
+
+// Set stores value under key, evicting the least recently used entry if
+// the cache is full
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.store(key, value)
+}
+
+// Delete removes key
+func (c *Cache[K, V]) Delete(key K) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// GetOrLoad returns the value stored under key. A fresh value is returned
+// as is. A stale one is returned too, and reloaded in the background. A
+// missing or expired one is loaded, with every concurrent caller for the
+// same key waiting on the same load. Errors are returned but not cached.
+// GetOrLoad gives up waiting when ctx is done.
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K, load func(ctx context.Context) (V, error)) (V, Lookup, error) {
+	c.mutex.Lock()
+	if e, ok := c.lookup(key); ok {
+		age := time.Since(e.stored)
+		if age < c.config.TTL {
+			c.stats.Hits++
+			c.mutex.Unlock()
+			return e.value, Lookup{Cached: true}, nil
+		}
+		if age < c.config.TTL+c.config.StaleTTL {
+			c.stats.StaleHits++
+			c.start(ctx, key, load)
+			c.mutex.Unlock()
+			return e.value, Lookup{Cached: true, Stale: true}, nil
+		}
+	}
+	c.stats.Misses++
+	f := c.start(ctx, key, load)
+	c.mutex.Unlock()
+
+	value, err := wait(ctx, f)
+	return value, Lookup{}, err
+}
+
+// Reload loads key regardless of what is cached and stores the result,
+// joining a load already in flight. It gives up waiting when ctx is done.
+func (c *Cache[K, V]) Reload(ctx context.Context, key K, load func(ctx context.Context) (V, error)) (V, error) {
+	c.mutex.Lock()
+	c.stats.Misses++
+	f := c.start(ctx, key, load)
+	c.mutex.Unlock()
+
+	return wait(ctx, f)
+}
+
+// Stats returns the counters and the current number of entries
+func (c *Cache[K, V]) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+// start returns the load in flight for key, starting one if there is none.
+// The load keeps ctx's values and deadline but not its cancellation. The
+// caller holds the mutex.
+func (c *Cache[K, V]) start(ctx context.Context, key K, load func(ctx context.Context) (V, error)) *flight[V] {
+	if f, ok := c.flights[key]; ok {
+		return f
+	}
+
+	f := &flight[V]{done: make(chan struct{})}
+	c.flights[key] = f
+	go func() {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			deadline = time.Now().Add(c.config.LoadTimeout)
+		}
+		loadCtx, cancel := context.WithDeadline(context.WithoutCancel(ctx), deadline)
+		defer cancel()
+		f.value, f.err = load(loadCtx)
+
+		c.mutex.Lock()
+		delete(c.flights, key)
+		if f.err == nil {
+			c.store(key, f.value)
+		}
+		c.mutex.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+// wait returns the result of f unless ctx is done first
+func wait[V any](ctx context.Context, f *flight[V]) (V, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// lookup returns the entry for key unless it is past its stale window, in
+// which case it is dropped. The caller holds the mutex.
+func (c *Cache[K, V]) lookup(key K) (*entry[K, V], bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := element.Value.(*entry[K, V])
+	if time.Since(e.stored) >= c.config.TTL+c.config.StaleTTL {
+		c.remove(element)
+		c.stats.Evictions++
+		return nil, false
+	}
+	c.recency.MoveToFront(element)
+	return e, true
+}
+
+// store adds or replaces key's entry. The caller holds the mutex.
+func (c *Cache[K, V]) store(key K, value V) {
+	if element, ok := c.entries[key]; ok {
+		element.Value = &entry[K, V]{key: key, value: value, stored: time.Now()}
+		c.recency.MoveToFront(element)
+		return
+	}
+
+	for len(c.entries) >= c.config.MaxEntries {
+		c.remove(c.recency.Back())
+		c.stats.Evictions++
+	}
+	c.entries[key] = c.recency.PushFront(&entry[K, V]{key: key, value: value, stored: time.Now()})
+}
+
+// remove drops element. The caller holds the mutex.
+func (c *Cache[K, V]) remove(element *list.Element) {
+	c.recency.Remove(element)
+	delete(c.entries, element.Value.(*entry[K, V]).key)
+}
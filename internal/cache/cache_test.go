@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// counter returns a loader yielding 1, 2, 3, ... and the number of loads
+func counter() (func(ctx context.Context) (int, error), *atomic.Int32) {
+	var loads atomic.Int32
+	return func(ctx context.Context) (int, error) {
+		return int(loads.Add(1)), nil
+	}, &loads
+}
+
+// waitFor polls until cond holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGetExpiresAfterTTL(t *testing.T) {
+	c := New[string, int](Config{TTL: 50 * time.Millisecond})
+	c.Set("btc", 1)
+
+	if value, ok := c.Get("btc"); !ok || value != 1 {
+		t.Errorf("Get() = %d, %v, want 1, true", value, ok)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := c.Get("btc"); ok {
+		t.Error("Get() after the TTL found the entry")
+	}
+	if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 0 {
+		t.Errorf("Stats() = %+v, want 1 hit, 1 miss and no entries", stats)
+	}
+}
+
+func TestGetOrLoadCachesFreshValue(t *testing.T) {
+	c := New[string, int](Config{TTL: time.Minute})
+	load, loads := counter()
+
+	value, lookup, err := c.GetOrLoad(context.Background(), "btc", load)
+	if err != nil || value != 1 || lookup.Cached {
+		t.Errorf("first GetOrLoad() = %d, %+v, %v, want a fresh load of 1", value, lookup, err)
+	}
+	value, lookup, err = c.GetOrLoad(context.Background(), "btc", load)
+	if err != nil || value != 1 || !lookup.Cached || lookup.Stale {
+		t.Errorf("second GetOrLoad() = %d, %+v, %v, want a cached 1", value, lookup, err)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loads = %d, want 1", n)
+	}
+}
+
+func TestGetOrLoadStaleWhileRevalidate(t *testing.T) {
+	c := New[string, int](Config{TTL: 30 * time.Millisecond, StaleTTL: time.Minute})
+	load, loads := counter()
+
+	c.GetOrLoad(context.Background(), "btc", load)
+	time.Sleep(40 * time.Millisecond)
+
+	// The stale value is served straight away and reloaded behind it
+	value, lookup, err := c.GetOrLoad(context.Background(), "btc", load)
+	if err != nil || value != 1 || !lookup.Cached || !lookup.Stale {
+		t.Errorf("stale GetOrLoad() = %d, %+v, %v, want a stale 1", value, lookup, err)
+	}
+	waitFor(t, func() bool {
+		value, ok := c.Get("btc")
+		return ok && value == 2
+	})
+	if n := loads.Load(); n != 2 {
+		t.Errorf("loads = %d, want 2", n)
+	}
+	if stats := c.Stats(); stats.StaleHits != 1 {
+		t.Errorf("Stats().StaleHits = %d, want 1", stats.StaleHits)
+	}
+}
+
+func TestGetOrLoadPastStaleWindow(t *testing.T) {
+	c := New[string, int](Config{TTL: 20 * time.Millisecond, StaleTTL: 20 * time.Millisecond})
+	load, _ := counter()
+
+	c.GetOrLoad(context.Background(), "btc", load)
+	time.Sleep(50 * time.Millisecond)
+
+	value, lookup, err := c.GetOrLoad(context.Background(), "btc", load)
+	if err != nil || value != 2 || lookup.Cached {
+		t.Errorf("expired GetOrLoad() = %d, %+v, %v, want a fresh load of 2", value, lookup, err)
+	}
+	if stats := c.Stats(); stats.Evictions != 1 {
+		t.Errorf("Stats().Evictions = %d, want the expired entry", stats.Evictions)
+	}
+}
+
+func TestGetOrLoadSharesLoad(t *testing.T) {
+	c := New[string, int](Config{TTL: time.Minute})
+	release := make(chan struct{})
+	var loads atomic.Int32
+	load := func(ctx context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	const callers = 10
+	values := make([]int, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], _, _ = c.GetOrLoad(context.Background(), "btc", load)
+		}(i)
+	}
+
+	waitFor(t, func() bool { return loads.Load() == 1 })
+	// Give the other callers time to join the load in flight
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, value := range values {
+		if value != 42 {
+			t.Errorf("caller %d got %d, want 42", i, value)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loads = %d, want 1", n)
+	}
+}
+
+func TestGetOrLoadDoesNotCacheErrors(t *testing.T) {
+	c := New[string, int](Config{TTL: time.Minute})
+	failure := errors.New("upstream down")
+	var loads atomic.Int32
+	load := func(ctx context.Context) (int, error) {
+		if loads.Add(1) == 1 {
+			return 0, failure
+		}
+		return 7, nil
+	}
+
+	if _, _, err := c.GetOrLoad(context.Background(), "btc", load); !errors.Is(err, failure) {
+		t.Errorf("first GetOrLoad() error = %v, want %v", err, failure)
+	}
+	value, _, err := c.GetOrLoad(context.Background(), "btc", load)
+	if err != nil || value != 7 {
+		t.Errorf("second GetOrLoad() = %d, %v, want 7", value, err)
+	}
+}
+
+func TestGetOrLoadOutlivesCaller(t *testing.T) {
+	c := New[string, int](Config{TTL: time.Minute})
+	release := make(chan struct{})
+	load := func(ctx context.Context) (int, error) {
+		<-release
+		return 1, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, _, err := c.GetOrLoad(ctx, "btc", load); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetOrLoad() error = %v, want context.Canceled", err)
+	}
+
+	// The load carries on and is stored for the next caller
+	close(release)
+	waitFor(t, func() bool {
+		_, ok := c.Get("btc")
+		return ok
+	})
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](Config{TTL: time.Minute, MaxEntries: 2})
+	c.Set("btc", 1)
+	c.Set("eth", 2)
+	c.Get("btc")
+	c.Set("sol", 3)
+
+	if _, ok := c.Get("eth"); ok {
+		t.Error("eth was kept, want it evicted as least recently used")
+	}
+	for _, key := range []string{"btc", "sol"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("Stats() = %+v, want 1 eviction and 2 entries", stats)
+	}
+}
+
+func TestSetReplacesWithoutEvicting(t *testing.T) {
+	c := New[string, int](Config{TTL: time.Minute, MaxEntries: 2})
+	c.Set("btc", 1)
+	c.Set("eth", 2)
+	c.Set("btc", 3)
+
+	if value, _ := c.Get("btc"); value != 3 {
+		t.Errorf("Get(btc) = %d, want 3", value)
+	}
+	if _, ok := c.Get("eth"); !ok {
+		t.Error("eth was evicted by replacing btc")
+	}
+
+	c.Delete("btc")
+	if _, ok := c.Get("btc"); ok {
+		t.Error("Get() found a deleted entry")
+	}
+}
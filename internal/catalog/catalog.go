@@ -0,0 +1,320 @@
+package catalog
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//go:embed coins.json
+var bundledCoins []byte
+
+// Coin maps a ticker to the id the price provider (CoinGecko) knows it by
+type Coin struct {
+	ID      string   `json:"id"`
+	Symbol  string   `json:"symbol"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	// Primary marks the coin a shared ticker resolves to by default
+	Primary bool `json:"primary,omitempty"`
+	// Subreddits are the coin's own communities, searched in addition to
+	// the general crypto subreddits
+	Subreddits []string `json:"subreddits,omitempty"`
+	// CommonWords lists the name or aliases that are also ordinary words,
+	// such as Stellar, which Mentions only counts when capitalized
+	CommonWords []string `json:"common_words,omitempty"`
+}
+
+// AmbiguousError is returned when a ticker is shared by several coins and
+// none of them is marked primary. Callers can retry with a provider id.
+type AmbiguousError struct {
+	Symbol     string
+	Candidates []Coin
+}
+
+func (e *AmbiguousError) Error() string {
+	ids := make([]string, len(e.Candidates))
+	for i, coin := range e.Candidates {
+		ids[i] = coin.ID
+	}
+	return fmt.Sprintf("symbol %s is ambiguous, use one of: %s", e.Symbol, strings.Join(ids, ", "))
+}
+
+// NotFoundError is returned when nothing in the catalog matches
+type NotFoundError struct {
+	Query string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no coin found for %q", e.Query)
+}
+
+// Catalog resolves tickers, names, aliases and provider ids to coins
+type Catalog struct {
+	coins    []Coin
+	byID     map[string]int
+	bySymbol map[string][]int
+	byName   map[string]int
+	// common holds the lower-cased names and aliases that are ordinary words
+	common map[string]bool
+	// nameWords is the most words in any name or alias
+	nameWords int
+}
+
+// Default returns the catalog bundled with the binary
+func Default() (*Catalog, error) {
+	return Load(bytes.NewReader(bundledCoins))
+}
+
+// LoadFile reads a catalog from a JSON file in the bundled format
+func LoadFile(path string) (*Catalog, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Load(file)
+}
+
+// Load reads a JSON array of coins. Duplicate ids, or more than one
+// primary coin for a ticker, are rejected.
+func Load(r io.Reader) (*Catalog, error) {
+	var coins []Coin
+	if err := json.NewDecoder(r).Decode(&coins); err != nil {
+		return nil, fmt.Errorf("error decoding coin catalog: %v", err)
+	}
+
+	c := &Catalog{
+		byID:     make(map[string]int, len(coins)),
+		bySymbol: make(map[string][]int, len(coins)),
+		byName:   make(map[string]int, len(coins)),
+		common:   make(map[string]bool),
+	}
+
+	for _, coin := range coins {
+		if coin.ID == "" || coin.Symbol == "" {
+			return nil, fmt.Errorf("coin catalog entry %+v needs an id and a symbol", coin)
+		}
+		coin.ID = strings.ToLower(coin.ID)
+		coin.Symbol = strings.ToUpper(coin.Symbol)
+
+		if _, ok := c.byID[coin.ID]; ok {
+			return nil, fmt.Errorf("duplicate coin id %q in catalog", coin.ID)
+		}
+		for _, other := range c.bySymbol[coin.Symbol] {
+			if coin.Primary && c.coins[other].Primary {
+				return nil, fmt.Errorf("symbol %s has more than one primary coin", coin.Symbol)
+			}
+		}
+
+		index := len(c.coins)
+		c.coins = append(c.coins, coin)
+		c.byID[coin.ID] = index
+		c.bySymbol[coin.Symbol] = append(c.bySymbol[coin.Symbol], index)
+
+		// Names and aliases that collide are dropped rather than guessed
+		names := make(map[string]bool)
+		for _, name := range append([]string{coin.Name}, coin.Aliases...) {
+			key := strings.ToLower(strings.TrimSpace(name))
+			if key == "" {
+				continue
+			}
+			names[key] = true
+			c.nameWords = max(c.nameWords, len(strings.Fields(key)))
+			if existing, ok := c.byName[key]; ok && existing != index {
+				c.byName[key] = -1
+				continue
+			}
+			c.byName[key] = index
+		}
+
+		for _, word := range coin.CommonWords {
+			key := strings.ToLower(strings.TrimSpace(word))
+			if !names[key] {
+				return nil, fmt.Errorf("common word %q of coin %s is not one of its names or aliases", word, coin.ID)
+			}
+			c.common[key] = true
+		}
+	}
+
+	return c, nil
+}
+
+// Coins returns every coin in catalog order
+func (c *Catalog) Coins() []Coin {
+	return append([]Coin(nil), c.coins...)
+}
+
+// IsAmbiguous reports whether more than one coin uses symbol
+func (c *Catalog) IsAmbiguous(symbol string) bool {
+	return len(c.bySymbol[strings.ToUpper(symbol)]) > 1
+}
+
+// Resolve finds the coin for a provider id, ticker, name or alias, in that
+// order of precedence. A shared ticker resolves to its primary coin and
+// otherwise fails with an *AmbiguousError.
+func (c *Catalog) Resolve(query string) (*Coin, error) {
+	query = strings.TrimSpace(query)
+
+	if index, ok := c.byID[strings.ToLower(query)]; ok {
+		coin := c.coins[index]
+		return &coin, nil
+	}
+
+	if indexes := c.bySymbol[strings.ToUpper(query)]; len(indexes) > 0 {
+		if len(indexes) == 1 {
+			coin := c.coins[indexes[0]]
+			return &coin, nil
+		}
+
+		candidates := make([]Coin, len(indexes))
+		for i, index := range indexes {
+			if c.coins[index].Primary {
+				coin := c.coins[index]
+				return &coin, nil
+			}
+			candidates[i] = c.coins[index]
+		}
+		return nil, &AmbiguousError{Symbol: strings.ToUpper(query), Candidates: candidates}
+	}
+
+	if index, ok := c.byName[strings.ToLower(query)]; ok && index >= 0 {
+		coin := c.coins[index]
+		return &coin, nil
+	}
+
+	return nil, &NotFoundError{Query: query}
+}
+
+// Search returns up to limit coins whose id, symbol, name or alias
+// contains query, exact matches first, then prefix matches. An empty
+// query lists the catalog. A limit of zero or less means no limit.
+func (c *Catalog) Search(query string, limit int) []Coin {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	type match struct {
+		coin Coin
+		rank int
+	}
+	var matches []match
+
+	for _, coin := range c.coins {
+		rank := -1
+		for _, field := range append([]string{coin.ID, coin.Symbol, coin.Name}, coin.Aliases...) {
+			field = strings.ToLower(field)
+			switch {
+			case field == query:
+				rank = 0
+			case strings.HasPrefix(field, query) && (rank < 0 || rank > 1):
+				rank = 1
+			case strings.Contains(field, query) && rank < 0:
+				rank = 2
+			}
+		}
+		if rank >= 0 {
+			matches = append(matches, match{coin: coin, rank: rank})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].rank < matches[j].rank
+	})
+
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	coins := make([]Coin, len(matches))
+	for i, m := range matches {
+		coins[i] = m.coin
+	}
+	return coins
+}
+
+// Mentions returns the tickers of the coins text refers to, in order of
+// first mention: cashtags such as $SOL, upper-case tickers of at least
+// three letters, and names and aliases in any case, the longest first so
+// that "Bitcoin Cash" isn't read as Bitcoin. A coin's common words must
+// be capitalized, so that "stellar results" isn't read as Stellar.
+// Tickers not in the catalog are ignored.
+func (c *Catalog) Mentions(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '$'
+	})
+
+	seen := make(map[string]bool)
+	var symbols []string
+	add := func(symbol string) {
+		if !seen[symbol] {
+			seen[symbol] = true
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if ticker, ok := strings.CutPrefix(word, "$"); ok {
+			if ticker = strings.ToUpper(ticker); len(c.bySymbol[ticker]) > 0 {
+				add(ticker)
+			}
+			continue
+		}
+		if len(word) >= 3 && word == strings.ToUpper(word) && len(c.bySymbol[word]) > 0 {
+			add(word)
+			continue
+		}
+
+		for n := min(c.nameWords, len(words)-i); n > 0; n-- {
+			phrase := strings.Join(words[i:i+n], " ")
+			key := strings.ToLower(phrase)
+			if c.common[key] && !unicode.IsUpper([]rune(phrase)[0]) {
+				continue
+			}
+			if index, ok := c.byName[key]; ok && index >= 0 {
+				add(c.coins[index].Symbol)
+				i += n - 1
+				break
+			}
+		}
+	}
+	return symbols
+}
+
+// QueryTerms returns the search terms for symbol on social platforms:
+// the ticker, its cashtag, and the coin's name and aliases. Unknown or
+// ambiguous tickers fall back to the ticker alone.
+func (c *Catalog) QueryTerms(symbol string) []string {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+
+	coin, err := c.Resolve(symbol)
+	if err != nil {
+		return []string{symbol}
+	}
+
+	terms := []string{coin.Symbol}
+	seen := map[string]bool{strings.ToLower(coin.Symbol): true}
+	for _, term := range append([]string{coin.Name}, coin.Aliases...) {
+		if key := strings.ToLower(term); key != "" && !seen[key] {
+			seen[key] = true
+			terms = append(terms, term)
+		}
+	}
+	return append(terms, "$"+coin.Symbol)
+}
+
+// Subreddits returns the dedicated subreddits of the coin symbol resolves
+// to, or nil for unknown and ambiguous tickers
+func (c *Catalog) Subreddits(symbol string) []string {
+	coin, err := c.Resolve(symbol)
+	if err != nil {
+		return nil
+	}
+	return append([]string(nil), coin.Subreddits...)
+}
@@ -0,0 +1,56 @@
+package catalog
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	coins, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"$sol and $BTC", []string{"SOL", "BTC"}},
+		{"ETH over BTC, not OP", []string{"ETH", "BTC"}},
+		{"bitcoin cash beats Bitcoin", []string{"BCH", "BTC"}},
+		{"stellar results, optimism and an avalanche of ether", nil},
+		{"Stellar and Polygon pump, Ether too", []string{"XLM", "MATIC", "ETH"}},
+		{"the cosmos hub upgrade", []string{"ATOM"}},
+		{"$xlm $op $pepe", []string{"XLM", "OP", "PEPE"}},
+		{"$NOTACOIN", nil},
+	}
+
+	for _, tt := range tests {
+		if got := coins.Mentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Mentions(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLoadCommonWords(t *testing.T) {
+	coins, err := Load(strings.NewReader(`[
+		{"id": "gold", "symbol": "GLD", "name": "Gold", "common_words": ["gold"]}
+	]`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := coins.Mentions("gold rallies while Gold coin pumps"); !reflect.DeepEqual(got, []string{"GLD"}) {
+		t.Errorf("Mentions() = %v, want GLD from the capitalized name only", got)
+	}
+	if got := coins.Mentions("gold rallies"); got != nil {
+		t.Errorf("Mentions() = %v, want nothing for the lower-case word", got)
+	}
+
+	_, err = Load(strings.NewReader(`[
+		{"id": "gold", "symbol": "GLD", "name": "Gold", "common_words": ["silver"]}
+	]`))
+	if err == nil {
+		t.Error("Load() accepted a common word that isn't a name or alias")
+	}
+}
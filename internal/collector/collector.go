@@ -0,0 +1,206 @@
+package collector
+
+import (
+	"context"
+	"crypto-sentiment/db"
+	"crypto-sentiment/internal/hub"
+	"crypto-sentiment/internal/models"
+	"crypto-sentiment/internal/services"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatchItem is one symbol the collector samples and how often
+type WatchItem struct {
+	Symbol   string
+	Interval time.Duration
+}
+
+type Config struct {
+	Watchlist []WatchItem
+	// MaxConcurrency caps how many symbols are collected at the same time
+	MaxConcurrency int
+	// Jitter is the maximum random offset added to every wait so that
+	// symbols sharing an interval don't all hit the upstreams at once
+	Jitter time.Duration
+}
+
+// Collector samples sentiment and price for every symbol in its watchlist
+// on a schedule and writes the results to the database.
+type Collector struct {
+	config           Config
+	sentimentService *services.SentimentService
+	coinService      *services.CoinService
+	events           *hub.Hub
+	intervals        map[string]time.Duration
+	slots            chan struct{}
+	wg               sync.WaitGroup
+}
+
+// New creates a collector. Every sample is also published to events, which
+// may be nil.
+func New(config Config, sentimentService *services.SentimentService, coinService *services.CoinService, events *hub.Hub) *Collector {
+	if config.MaxConcurrency < 1 {
+		config.MaxConcurrency = 1
+	}
+
+	intervals := make(map[string]time.Duration, len(config.Watchlist))
+	for i, item := range config.Watchlist {
+		config.Watchlist[i].Symbol = strings.ToUpper(item.Symbol)
+		intervals[config.Watchlist[i].Symbol] = item.Interval
+	}
+
+	return &Collector{
+		config:           config,
+		sentimentService: sentimentService,
+		coinService:      coinService,
+		events:           events,
+		intervals:        intervals,
+		slots:            make(chan struct{}, config.MaxConcurrency),
+	}
+}
+
+// Symbols returns the watched symbols in watchlist order
+func (c *Collector) Symbols() []string {
+	symbols := make([]string, len(c.config.Watchlist))
+	for i, item := range c.config.Watchlist {
+		symbols[i] = item.Symbol
+	}
+	return symbols
+}
+
+// Interval returns how often symbol is sampled and whether it is watched
+func (c *Collector) Interval(symbol string) (time.Duration, bool) {
+	interval, ok := c.intervals[strings.ToUpper(symbol)]
+	return interval, ok
+}
+
+// Run starts one schedule per watched symbol and blocks until ctx is
+// cancelled and every in-flight collection has finished.
+func (c *Collector) Run(ctx context.Context) {
+	for _, item := range c.config.Watchlist {
+		c.wg.Add(1)
+		go c.schedule(ctx, item)
+	}
+
+	log.Printf("Collector started for %d symbols", len(c.config.Watchlist))
+	<-ctx.Done()
+	c.wg.Wait()
+	log.Println("Collector stopped")
+}
+
+func (c *Collector) schedule(ctx context.Context, item WatchItem) {
+	defer c.wg.Done()
+
+	// Spread the first round out instead of starting every symbol at once
+	wait := c.jitter()
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case c.slots <- struct{}{}:
+		}
+		// A round may take at most the interval, so rounds never overlap
+		roundCtx, cancel := context.WithTimeout(ctx, item.Interval)
+		c.Collect(roundCtx, item.Symbol)
+		cancel()
+		<-c.slots
+
+		wait = item.Interval + c.jitter()
+	}
+}
+
+func (c *Collector) jitter() time.Duration {
+	if c.config.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(c.config.Jitter)))
+}
+
+// Collect samples sentiment and price for symbol once and stores both.
+// Failures are logged so that one bad upstream doesn't stop the schedule.
+// Fetches stop when ctx is done.
+func (c *Collector) Collect(ctx context.Context, symbol string) {
+	data, err := c.sentimentService.Compute(ctx, symbol)
+	if err != nil {
+		log.Printf("Collector: sentiment for %s failed: %v", symbol, err)
+	} else {
+		if err := db.SaveSentiment(data); err != nil {
+			log.Printf("Collector: failed to save sentiment for %s: %v", symbol, err)
+		}
+		c.publish(hub.SentimentEvent(data))
+	}
+
+	if c.coinService == nil {
+		return
+	}
+
+	coin, err := c.coinService.GetCoinData(ctx, symbol)
+	if err != nil {
+		log.Printf("Collector: price for %s failed: %v", symbol, err)
+		return
+	}
+
+	price := &models.PriceData{
+		Symbol:         strings.ToUpper(symbol),
+		Price:          coin.CurrentPrice,
+		PriceChange24h: coin.PriceChange24h,
+		MarketCap:      coin.MarketCap,
+		Timestamp:      coin.LastUpdated,
+	}
+	// A price still cached from the previous tick is neither stored nor
+	// published again
+	inserted, err := db.SavePrice(price)
+	if err != nil {
+		log.Printf("Collector: failed to save price for %s: %v", symbol, err)
+	}
+	if inserted || err != nil {
+		c.publish(hub.PriceEvent(price))
+	}
+}
+
+func (c *Collector) publish(event hub.Event) {
+	if c.events != nil {
+		c.events.Publish(event)
+	}
+}
+
+// ParseWatchlist parses a comma-separated list of SYMBOL or SYMBOL:interval
+// entries, e.g. "BTC:5m,ETH,DOGE:15m". Entries without an interval use
+// defaultInterval.
+func ParseWatchlist(value string, defaultInterval time.Duration) ([]WatchItem, error) {
+	var watchlist []WatchItem
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		item := WatchItem{Symbol: entry, Interval: defaultInterval}
+		if symbol, interval, ok := strings.Cut(entry, ":"); ok {
+			parsed, err := time.ParseDuration(interval)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid interval for %s: %q", symbol, interval)
+			}
+			item = WatchItem{Symbol: strings.TrimSpace(symbol), Interval: parsed}
+		}
+		item.Symbol = strings.ToUpper(item.Symbol)
+
+		watchlist = append(watchlist, item)
+	}
+
+	return watchlist, nil
+}
@@ -0,0 +1,196 @@
+package diagnose
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Check outcomes
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+// Check is a single diagnostic. Run returns a short description of what
+// it found. A check with a SkipReason is reported without running.
+type Check struct {
+	Name       string
+	SkipReason string
+	Run        func(ctx context.Context) (string, error)
+}
+
+// Result is the outcome of one Check
+type Result struct {
+	Check              string `json:"check"`
+	Status             string `json:"status"`
+	LatencyMS          int64  `json:"latency_ms"`
+	HTTPStatus         int    `json:"http_status,omitempty"`
+	RateLimitRemaining *int   `json:"rate_limit_remaining,omitempty"`
+	Detail             string `json:"detail,omitempty"`
+}
+
+// Recorder is an http.RoundTripper that remembers the status and rate
+// limit of the last response, so that checks built on the services can
+// report them without the services exposing their responses
+type Recorder struct {
+	Base http.RoundTripper
+
+	mutex     sync.Mutex
+	status    int
+	remaining *int
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := r.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.status = resp.StatusCode
+	for _, header := range []string{"X-Ratelimit-Remaining", "X-Rate-Limit-Remaining"} {
+		if value, err := strconv.ParseFloat(resp.Header.Get(header), 64); err == nil {
+			remaining := int(math.Floor(value))
+			r.remaining = &remaining
+			break
+		}
+	}
+	return resp, nil
+}
+
+// reset forgets the last response and returns what it was
+func (r *Recorder) reset() (int, *int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	status, remaining := r.status, r.remaining
+	r.status, r.remaining = 0, nil
+	return status, remaining
+}
+
+// Run executes checks in order, each with its own timeout. Every secret
+// is masked in the details, which may quote upstream error messages.
+func Run(ctx context.Context, checks []Check, recorder *Recorder, timeout time.Duration, secrets []string) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, check := range checks {
+		result := Result{Check: check.Name}
+		if check.SkipReason != "" {
+			result.Status = StatusSkip
+			result.Detail = check.SkipReason
+			results = append(results, result)
+			continue
+		}
+
+		if recorder != nil {
+			recorder.reset()
+		}
+		start := time.Now()
+		detail, err := runWithTimeout(ctx, check, timeout)
+		result.LatencyMS = time.Since(start).Milliseconds()
+
+		result.Status = StatusPass
+		result.Detail = detail
+		if err != nil {
+			result.Status = StatusFail
+			result.Detail = err.Error()
+		}
+		if recorder != nil {
+			result.HTTPStatus, result.RateLimitRemaining = recorder.reset()
+		}
+		result.Detail = redact(result.Detail, secrets)
+		results = append(results, result)
+	}
+	return results
+}
+
+// runWithTimeout gives up on check after timeout even if it ignores its
+// context
+func runWithTimeout(ctx context.Context, check Check, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		detail string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		detail, err := check.Run(ctx)
+		done <- outcome{detail, err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.detail, result.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// Passed reports whether no check failed
+func Passed(results []Result) bool {
+	for _, result := range results {
+		if result.Status == StatusFail {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTable prints results as an aligned table
+func WriteTable(w io.Writer, results []Result) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CHECK\tSTATUS\tLATENCY\tHTTP\tREMAINING\tDETAIL")
+	for _, result := range results {
+		latency, status, remaining := "-", "-", "-"
+		if result.Status != StatusSkip {
+			latency = fmt.Sprintf("%dms", result.LatencyMS)
+		}
+		if result.HTTPStatus != 0 {
+			status = strconv.Itoa(result.HTTPStatus)
+		}
+		if result.RateLimitRemaining != nil {
+			remaining = strconv.Itoa(*result.RateLimitRemaining)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			result.Check, strings.ToUpper(result.Status), latency, status, remaining, result.Detail)
+	}
+	return table.Flush()
+}
+
+// WriteJSON prints results as an indented JSON document
+func WriteJSON(w io.Writer, results []Result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]interface{}{
+		"passed": Passed(results),
+		"checks": results,
+	})
+}
+
+// redact masks every occurrence of a secret in text
+func redact(text string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, "[REDACTED]")
+		}
+	}
+	return text
+}
@@ -0,0 +1,71 @@
+package fanout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Defaults for the Config limits
+const (
+	defaultConcurrency = 4
+	defaultTimeout     = 15 * time.Second
+)
+
+// Config bounds a fan-out. Zero values take their defaults.
+type Config struct {
+	// Concurrency caps how many items are processed at the same time
+	Concurrency int
+	// Timeout bounds each item, within the deadline of the whole run
+	Timeout time.Duration
+}
+
+// Result is the outcome of one item
+type Result[T any] struct {
+	Value   T
+	Err     error
+	Elapsed time.Duration
+}
+
+// Run calls fn for every item on a pool of at most Concurrency workers,
+// each call under its own Timeout, and returns the results in the order of
+// items. Items still waiting when ctx is done are not started and get
+// ctx's error.
+func Run[I, T any](ctx context.Context, items []I, config Config, fn func(ctx context.Context, item I) (T, error)) []Result[T] {
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultConcurrency
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+
+	results := make([]Result[T], len(items))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(config.Concurrency, len(items)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+
+				itemCtx, cancel := context.WithTimeout(ctx, config.Timeout)
+				start := time.Now()
+				results[i].Value, results[i].Err = fn(itemCtx, items[i])
+				results[i].Elapsed = time.Since(start)
+				cancel()
+			}
+		}()
+	}
+
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,127 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunKeepsItemOrder(t *testing.T) {
+	items := []int{5, 1, 4, 2, 3}
+	// Later items finish first, so results arrive out of order
+	results := Run(context.Background(), items, Config{Concurrency: len(items)}, func(ctx context.Context, item int) (int, error) {
+		time.Sleep(time.Duration(item) * 5 * time.Millisecond)
+		return item * 10, nil
+	})
+
+	if len(results) != len(items) {
+		t.Fatalf("len(results) = %d, want %d", len(results), len(items))
+	}
+	for i, result := range results {
+		if result.Err != nil || result.Value != items[i]*10 {
+			t.Errorf("results[%d] = %d, %v, want %d", i, result.Value, result.Err, items[i]*10)
+		}
+		if result.Elapsed <= 0 {
+			t.Errorf("results[%d].Elapsed = %v, want it measured", i, result.Elapsed)
+		}
+	}
+}
+
+func TestRunCapsConcurrency(t *testing.T) {
+	const concurrency = 3
+	var running, peak atomic.Int32
+	items := make([]int, 12)
+
+	Run(context.Background(), items, Config{Concurrency: concurrency}, func(ctx context.Context, item int) (int, error) {
+		n := running.Add(1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		running.Add(-1)
+		return item, nil
+	})
+
+	if p := peak.Load(); p != concurrency {
+		t.Errorf("peak concurrency = %d, want %d", p, concurrency)
+	}
+}
+
+func TestRunTimesOutEachItem(t *testing.T) {
+	items := []time.Duration{time.Second, 0}
+	start := time.Now()
+	results := Run(context.Background(), items, Config{Concurrency: 1, Timeout: 20 * time.Millisecond}, func(ctx context.Context, delay time.Duration) (string, error) {
+		select {
+		case <-time.After(delay):
+			return "done", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	})
+
+	if !errors.Is(results[0].Err, context.DeadlineExceeded) {
+		t.Errorf("slow item error = %v, want context.DeadlineExceeded", results[0].Err)
+	}
+	// The next item gets a timeout of its own
+	if results[1].Err != nil || results[1].Value != "done" {
+		t.Errorf("fast item = %q, %v, want done", results[1].Value, results[1].Err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Run() took %s, want the slow item cut off", elapsed)
+	}
+}
+
+func TestRunReportsPartialFailure(t *testing.T) {
+	failure := errors.New("upstream down")
+	items := []string{"BTC", "FAIL", "ETH"}
+	results := Run(context.Background(), items, Config{}, func(ctx context.Context, symbol string) (string, error) {
+		if symbol == "FAIL" {
+			return "", failure
+		}
+		return symbol + "!", nil
+	})
+
+	if results[0].Value != "BTC!" || results[2].Value != "ETH!" {
+		t.Errorf("results = %+v, want the other items to succeed", results)
+	}
+	if !errors.Is(results[1].Err, failure) {
+		t.Errorf("results[1].Err = %v, want %v", results[1].Err, failure)
+	}
+}
+
+func TestRunSkipsItemsAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int32
+	results := Run(ctx, []int{1, 2, 3, 4}, Config{Concurrency: 1}, func(ctx context.Context, item int) (int, error) {
+		calls.Add(1)
+		cancel()
+		return item, nil
+	})
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("calls = %d, want the items after cancel skipped", n)
+	}
+	if results[0].Err != nil {
+		t.Errorf("results[0].Err = %v, want the started item to finish", results[0].Err)
+	}
+	for i, result := range results[1:] {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("results[%d].Err = %v, want context.Canceled", i+1, result.Err)
+		}
+	}
+}
+
+func TestRunWithoutItems(t *testing.T) {
+	results := Run(context.Background(), nil, Config{}, func(ctx context.Context, item int) (int, error) {
+		t.Error("fn called without items")
+		return 0, nil
+	})
+	if len(results) != 0 {
+		t.Errorf("len(results) = %d, want 0", len(results))
+	}
+}
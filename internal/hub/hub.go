@@ -0,0 +1,203 @@
+package hub
+
+import (
+	"crypto-sentiment/internal/models"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types
+const (
+	EventSentiment = "sentiment"
+	EventPrice     = "price"
+)
+
+// Event is an update for one symbol. Exactly one of Sentiment and Price is
+// set, depending on Type.
+type Event struct {
+	Type      string                `json:"type"`
+	Symbol    string                `json:"symbol"`
+	Sentiment *models.SentimentData `json:"sentiment,omitempty"`
+	Price     *models.PriceData     `json:"price,omitempty"`
+	Timestamp time.Time             `json:"timestamp"`
+}
+
+// SentimentEvent wraps a sentiment result
+func SentimentEvent(data *models.SentimentData) Event {
+	return Event{Type: EventSentiment, Symbol: data.Symbol, Sentiment: data, Timestamp: data.Timestamp}
+}
+
+// PriceEvent wraps a price sample
+func PriceEvent(price *models.PriceData) Event {
+	return Event{Type: EventPrice, Symbol: price.Symbol, Price: price, Timestamp: price.Timestamp}
+}
+
+// Hub fans events out to the subscribers of their symbol. It is safe for
+// concurrent use.
+type Hub struct {
+	mutex       sync.RWMutex
+	subscribers map[*Subscription]struct{}
+}
+
+func New() *Hub {
+	return &Hub{subscribers: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a subscriber with room for buffer undelivered events
+func (h *Hub) Subscribe(buffer int) *Subscription {
+	return h.subscribe(buffer, false)
+}
+
+// SubscribeAll registers a subscriber to the events of every symbol. Its
+// symbols aren't reported by Symbols.
+func (h *Hub) SubscribeAll(buffer int) *Subscription {
+	return h.subscribe(buffer, true)
+}
+
+func (h *Hub) subscribe(buffer int, all bool) *Subscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+
+	s := &Subscription{
+		hub:     h,
+		events:  make(chan Event, buffer),
+		all:     all,
+		symbols: make(map[string]bool),
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.subscribers[s] = struct{}{}
+	return s
+}
+
+// Publish delivers event to every subscriber of its symbol without
+// blocking. A subscriber whose buffer is full loses its oldest event, so
+// that a slow client falls behind on history but not on the latest state.
+func (h *Hub) Publish(event Event) {
+	event.Symbol = strings.ToUpper(event.Symbol)
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for s := range h.subscribers {
+		if s.Has(event.Symbol) {
+			s.deliver(event)
+		}
+	}
+}
+
+// Symbols returns every symbol that has at least one subscriber
+func (h *Hub) Symbols() []string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	var symbols []string
+	for s := range h.subscribers {
+		for _, symbol := range s.Symbols() {
+			if !seen[symbol] {
+				seen[symbol] = true
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	return symbols
+}
+
+// Subscription receives the events for the symbols it is subscribed to
+type Subscription struct {
+	hub     *Hub
+	events  chan Event
+	all     bool
+	dropped atomic.Int64
+
+	// sendMutex serializes deliveries so that dropping the oldest event
+	// and queueing the new one happen together
+	sendMutex sync.Mutex
+
+	mutex   sync.RWMutex
+	symbols map[string]bool
+}
+
+// Events returns the channel events are delivered on
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Add subscribes to symbol
+func (s *Subscription) Add(symbol string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.symbols[strings.ToUpper(symbol)] = true
+}
+
+// Remove unsubscribes from symbol
+func (s *Subscription) Remove(symbol string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.symbols, strings.ToUpper(symbol))
+}
+
+// Has reports whether the subscription covers symbol
+func (s *Subscription) Has(symbol string) bool {
+	if s.all {
+		return true
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.symbols[strings.ToUpper(symbol)]
+}
+
+// Symbols returns the subscribed symbols
+func (s *Subscription) Symbols() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	symbols := make([]string, 0, len(s.symbols))
+	for symbol := range s.symbols {
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// Dropped counts the events lost because the subscriber fell behind
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Send delivers event to this subscriber alone, e.g. an initial snapshot
+func (s *Subscription) Send(event Event) {
+	s.deliver(event)
+}
+
+// Close unregisters the subscription. No events are delivered afterwards.
+func (s *Subscription) Close() {
+	s.hub.mutex.Lock()
+	defer s.hub.mutex.Unlock()
+	delete(s.hub.subscribers, s)
+}
+
+func (s *Subscription) deliver(event Event) {
+	s.sendMutex.Lock()
+	defer s.sendMutex.Unlock()
+
+	for {
+		select {
+		case s.events <- event:
+			return
+		default:
+		}
+
+		// Full: make room by dropping the oldest event
+		select {
+		case <-s.events:
+			s.dropped.Add(1)
+		default:
+		}
+	}
+}
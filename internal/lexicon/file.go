@@ -0,0 +1,134 @@
+package lexicon
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxWeight bounds the magnitude of any single term
+const maxWeight = 5.0
+
+// fileLexicon is the format of JSON and YAML lexicon files. Terms listed
+// under positive or negative must carry a weight of that sign; terms under
+// "terms" take their polarity from the sign of the weight. Remove deletes
+// terms defined by the built-in dictionary or by earlier files.
+type fileLexicon struct {
+	Positive map[string]float64 `json:"positive,omitempty" yaml:"positive"`
+	Negative map[string]float64 `json:"negative,omitempty" yaml:"negative"`
+	Terms    map[string]float64 `json:"terms,omitempty" yaml:"terms"`
+	Remove   []string           `json:"remove,omitempty" yaml:"remove"`
+}
+
+// supportedExtensions lists the file types read from the lexicon directory
+var supportedExtensions = map[string]bool{
+	".json": true,
+	".yaml": true,
+	".yml":  true,
+	".csv":  true,
+}
+
+// readFile parses a lexicon file in the format given by its extension
+func readFile(path string) (*fileLexicon, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lexicon *fileLexicon
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		lexicon = &fileLexicon{}
+		err = json.NewDecoder(file).Decode(lexicon)
+	case ".yaml", ".yml":
+		lexicon = &fileLexicon{}
+		err = yaml.NewDecoder(file).Decode(lexicon)
+		if err == io.EOF {
+			err = nil
+		}
+	case ".csv":
+		lexicon, err = readCSV(file)
+	default:
+		return nil, fmt.Errorf("unsupported lexicon file %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	if err := lexicon.validate(); err != nil {
+		return nil, fmt.Errorf("invalid lexicon %s: %v", path, err)
+	}
+	return lexicon, nil
+}
+
+// readCSV reads "term,weight" rows. A header row and lines starting with
+// # are skipped.
+func readCSV(r io.Reader) (*fileLexicon, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	lexicon := &fileLexicon{Terms: make(map[string]float64)}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		weight, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: invalid weight %q", line, record[1])
+		}
+		lexicon.Terms[record[0]] = weight
+	}
+
+	return lexicon, nil
+}
+
+func (l *fileLexicon) validate() error {
+	for term, weight := range l.Positive {
+		if weight <= 0 || weight > maxWeight {
+			return fmt.Errorf("positive term %q needs a weight in (0, %g]", term, maxWeight)
+		}
+	}
+	for term, weight := range l.Negative {
+		if weight >= 0 || weight < -maxWeight {
+			return fmt.Errorf("negative term %q needs a weight in [-%g, 0)", term, maxWeight)
+		}
+	}
+	for term, weight := range l.Terms {
+		if weight == 0 || weight > maxWeight || weight < -maxWeight {
+			return fmt.Errorf("term %q needs a non-zero weight within ±%g", term, maxWeight)
+		}
+	}
+	return nil
+}
+
+// writeJSON atomically replaces path with lexicon encoded as JSON
+func writeJSON(path string, lexicon *fileLexicon) error {
+	data, err := json.MarshalIndent(lexicon, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,122 @@
+package lexicon
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFile creates name in dir with content
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    *fileLexicon
+		wantErr bool
+	}{
+		{
+			name:    "json sections",
+			file:    "terms.json",
+			content: `{"positive": {"pump": 1.5}, "negative": {"dump": -2}, "terms": {"hodl": 0.5}, "remove": ["moon"]}`,
+			want: &fileLexicon{
+				Positive: map[string]float64{"pump": 1.5},
+				Negative: map[string]float64{"dump": -2},
+				Terms:    map[string]float64{"hodl": 0.5},
+				Remove:   []string{"moon"},
+			},
+		},
+		{
+			name:    "yaml sections",
+			file:    "terms.yaml",
+			content: "positive:\n  pump: 1.5\nterms:\n  rug pull: -3\nremove:\n  - moon\n",
+			want: &fileLexicon{
+				Positive: map[string]float64{"pump": 1.5},
+				Terms:    map[string]float64{"rug pull": -3},
+				Remove:   []string{"moon"},
+			},
+		},
+		{
+			name: "empty yaml",
+			file: "empty.yml",
+			want: &fileLexicon{},
+		},
+		{
+			name:    "csv with header and comments",
+			file:    "terms.csv",
+			content: "term,weight\n# seasonal\npump, 1.5\ndump,-2\n",
+			want:    &fileLexicon{Terms: map[string]float64{"pump": 1.5, "dump": -2}},
+		},
+		{
+			name:    "csv with a bad weight",
+			file:    "terms.csv",
+			content: "pump,1.5\ndump,lots\n",
+			wantErr: true,
+		},
+		{
+			name:    "malformed json",
+			file:    "terms.json",
+			content: `{"positive": `,
+			wantErr: true,
+		},
+		{
+			name:    "positive term with a negative weight",
+			file:    "terms.json",
+			content: `{"positive": {"pump": -1}}`,
+			wantErr: true,
+		},
+		{
+			name:    "negative term with a positive weight",
+			file:    "terms.yaml",
+			content: "negative:\n  dump: 1\n",
+			wantErr: true,
+		},
+		{
+			name:    "weight beyond the maximum",
+			file:    "terms.csv",
+			content: "pump,6\n",
+			wantErr: true,
+		},
+		{
+			name:    "zero weight",
+			file:    "terms.json",
+			content: `{"terms": {"meh": 0}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported extension",
+			file:    "terms.txt",
+			content: "pump 1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, t.TempDir(), tt.file, tt.content)
+			got, err := readFile(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readFile() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+package lexicon
+
+import (
+	"context"
+	"crypto-sentiment/internal/services"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// OverridesFile holds the changes made through Patch. It is read after
+// every other file in the directory so that patches always win.
+const OverridesFile = "overrides.json"
+
+// maxVersions is how many past dictionaries are kept for rollback
+const maxVersions = 20
+
+// Dictionary is one version of the analyzer's vocabulary
+type Dictionary struct {
+	Version   int                `json:"version"`
+	UpdatedAt time.Time          `json:"updated_at"`
+	Source    string             `json:"source"`
+	Positive  map[string]float64 `json:"positive"`
+	Negative  map[string]float64 `json:"negative"`
+}
+
+// VersionInfo summarizes a Dictionary without its terms
+type VersionInfo struct {
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Source    string    `json:"source"`
+	Positive  int       `json:"positive_terms"`
+	Negative  int       `json:"negative_terms"`
+}
+
+// Patch sets or removes individual terms. Set weights follow the sign
+// convention of the "terms" section of lexicon files.
+type Patch struct {
+	Set    map[string]float64 `json:"set"`
+	Remove []string           `json:"remove"`
+}
+
+// Manager loads the analyzer's dictionaries from a directory of lexicon
+// files, reloads them when the files change, and keeps a version history.
+type Manager struct {
+	dir      string
+	analyzer *services.SentimentAnalyzer
+	// builtin is the analyzer's vocabulary before any file was applied
+	builtin   Dictionary
+	overrides *fileLexicon
+	// fingerprint identifies the directory contents last loaded
+	fingerprint string
+	history     []Dictionary
+	mutex       sync.Mutex
+}
+
+// NewManager captures the analyzer's current dictionaries as the built-in
+// base that lexicon files extend. An empty dir keeps everything in memory.
+func NewManager(dir string, analyzer *services.SentimentAnalyzer) *Manager {
+	positive, negative := analyzer.Dictionaries()
+	builtin := Dictionary{
+		Version:   1,
+		UpdatedAt: time.Now(),
+		Source:    "builtin",
+		Positive:  positive,
+		Negative:  negative,
+	}
+
+	return &Manager{
+		dir:       dir,
+		analyzer:  analyzer,
+		builtin:   builtin,
+		overrides: &fileLexicon{},
+		history:   []Dictionary{builtin},
+	}
+}
+
+// Load rebuilds the dictionaries from the built-in base, every lexicon
+// file in the directory in name order, and finally the overrides. The
+// analyzer is only updated, and a new version recorded, when the result
+// differs from the active dictionary.
+func (m *Manager) Load() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.load("files")
+}
+
+func (m *Manager) load(source string) error {
+	files, fingerprint, err := m.scan()
+	if err != nil {
+		return err
+	}
+
+	// Every file is parsed before anything changes, so that a malformed
+	// file keeps the current overrides
+	positive, negative, overrides, err := m.build(files, nil)
+	if err != nil {
+		return err
+	}
+
+	m.overrides = overrides
+	m.fingerprint = fingerprint
+	m.activate(source, positive, negative)
+	return nil
+}
+
+// build merges the built-in base, files and the overrides into new
+// dictionaries without changing the manager. overrides replaces the
+// contents of OverridesFile when given; otherwise the file is read, and a
+// deleted file clears them.
+func (m *Manager) build(files []string, overrides *fileLexicon) (map[string]float64, map[string]float64, *fileLexicon, error) {
+	pending := overrides != nil
+	if !pending {
+		overrides = m.overrides
+		if m.dir != "" {
+			overrides = &fileLexicon{}
+		}
+	}
+
+	layers := make([]*fileLexicon, 0, len(files)+1)
+	for _, path := range files {
+		if pending && filepath.Base(path) == OverridesFile {
+			continue
+		}
+		lexicon, err := readFile(path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if filepath.Base(path) == OverridesFile {
+			overrides = lexicon
+			continue
+		}
+		layers = append(layers, lexicon)
+	}
+	layers = append(layers, overrides)
+
+	positive := copyTerms(m.builtin.Positive)
+	negative := copyTerms(m.builtin.Negative)
+	for _, layer := range layers {
+		apply(layer, positive, negative)
+	}
+	return positive, negative, overrides, nil
+}
+
+// scan lists the lexicon files in the directory, overrides last, along
+// with a fingerprint of their names, sizes and modification times
+func (m *Manager) scan() ([]string, string, error) {
+	if m.dir == "" {
+		return nil, "", nil
+	}
+
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading lexicon directory: %v", err)
+	}
+
+	var (
+		files       []string
+		overrides   string
+		fingerprint strings.Builder
+	)
+	for _, entry := range entries {
+		if entry.IsDir() || !supportedExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, "", err
+		}
+		fmt.Fprintf(&fingerprint, "%s:%d:%d;", entry.Name(), info.Size(), info.ModTime().UnixNano())
+
+		path := filepath.Join(m.dir, entry.Name())
+		if entry.Name() == OverridesFile {
+			overrides = path
+			continue
+		}
+		files = append(files, path)
+	}
+
+	sort.Strings(files)
+	if overrides != "" {
+		files = append(files, overrides)
+	}
+	return files, fingerprint.String(), nil
+}
+
+// activate pushes the dictionaries to the analyzer as a new version unless
+// they match the active one. Must be called with the mutex held.
+func (m *Manager) activate(source string, positive, negative map[string]float64) {
+	active := m.history[len(m.history)-1]
+	if reflect.DeepEqual(active.Positive, positive) && reflect.DeepEqual(active.Negative, negative) {
+		return
+	}
+
+	m.analyzer.UpdateDictionaries(positive, negative)
+
+	dictionary := Dictionary{
+		Version:   active.Version + 1,
+		UpdatedAt: time.Now(),
+		Source:    source,
+		Positive:  positive,
+		Negative:  negative,
+	}
+	m.history = append(m.history, dictionary)
+	if len(m.history) > maxVersions {
+		m.history = m.history[len(m.history)-maxVersions:]
+	}
+
+	log.Printf("Lexicon version %d active (%s, %d positive, %d negative terms)",
+		dictionary.Version, source, len(positive), len(negative))
+}
+
+// Current returns the active dictionary
+func (m *Manager) Current() Dictionary {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.history[len(m.history)-1]
+}
+
+// Versions lists the retained versions, oldest first
+func (m *Manager) Versions() []VersionInfo {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	versions := make([]VersionInfo, len(m.history))
+	for i, dictionary := range m.history {
+		versions[i] = VersionInfo{
+			Version:   dictionary.Version,
+			UpdatedAt: dictionary.UpdatedAt,
+			Source:    dictionary.Source,
+			Positive:  len(dictionary.Positive),
+			Negative:  len(dictionary.Negative),
+		}
+	}
+	return versions
+}
+
+// Apply records patch in the overrides, persisting them to OverridesFile
+// when a directory is configured, and reloads the dictionaries. Nothing is
+// saved or changed when the dictionaries can't be rebuilt.
+func (m *Manager) Apply(patch Patch) (Dictionary, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := (&fileLexicon{Terms: patch.Set}).validate(); err != nil {
+		return Dictionary{}, err
+	}
+
+	overrides := &fileLexicon{
+		Terms:  copyTerms(m.overrides.Terms),
+		Remove: append([]string(nil), m.overrides.Remove...),
+	}
+	// Fold the signed sections into Terms so that one place holds each term
+	for term, weight := range m.overrides.Positive {
+		overrides.Terms[term] = weight
+	}
+	for term, weight := range m.overrides.Negative {
+		overrides.Terms[term] = weight
+	}
+
+	for term, weight := range patch.Set {
+		term = services.NormalizeTerm(term)
+		if term == "" {
+			continue
+		}
+		overrides.Terms[term] = weight
+		overrides.Remove = without(overrides.Remove, term)
+	}
+	for _, term := range patch.Remove {
+		term = services.NormalizeTerm(term)
+		if term == "" {
+			continue
+		}
+		delete(overrides.Terms, term)
+		overrides.Remove = append(without(overrides.Remove, term), term)
+	}
+
+	// The new dictionaries are built before the overrides are saved, so
+	// that a malformed lexicon file fails the patch without keeping it
+	files, _, err := m.scan()
+	if err != nil {
+		return Dictionary{}, err
+	}
+	positive, negative, _, err := m.build(files, overrides)
+	if err != nil {
+		return Dictionary{}, err
+	}
+
+	if m.dir != "" {
+		if err := writeJSON(filepath.Join(m.dir, OverridesFile), overrides); err != nil {
+			return Dictionary{}, fmt.Errorf("error saving lexicon overrides: %v", err)
+		}
+		// Record the saved file so that the watcher doesn't load it again
+		if _, fingerprint, err := m.scan(); err == nil {
+			m.fingerprint = fingerprint
+		}
+	}
+	m.overrides = overrides
+
+	m.activate("patch", positive, negative)
+	return m.history[len(m.history)-1], nil
+}
+
+// Rollback reactivates a retained version as a new version. The next file
+// change or reload replaces it again.
+func (m *Manager) Rollback(version int) (Dictionary, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, dictionary := range m.history {
+		if dictionary.Version == version {
+			m.activate(fmt.Sprintf("rollback to %d", version),
+				copyTerms(dictionary.Positive), copyTerms(dictionary.Negative))
+			return m.history[len(m.history)-1], nil
+		}
+	}
+	return Dictionary{}, fmt.Errorf("lexicon version %d is not retained", version)
+}
+
+// Watch reloads the dictionaries whenever the directory contents change,
+// checking every interval, and on SIGHUP. It blocks until ctx is cancelled.
+func (m *Manager) Watch(ctx context.Context, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			log.Println("SIGHUP received, reloading lexicon")
+			if err := m.Load(); err != nil {
+				log.Printf("Lexicon reload failed: %v", err)
+			}
+		case <-ticker.C:
+			if m.dir == "" {
+				continue
+			}
+			m.mutex.Lock()
+			_, fingerprint, err := m.scan()
+			changed := err == nil && fingerprint != m.fingerprint
+			m.mutex.Unlock()
+
+			if err != nil {
+				log.Printf("Lexicon scan failed: %v", err)
+			} else if changed {
+				if err := m.Load(); err != nil {
+					log.Printf("Lexicon reload failed: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// apply merges one lexicon layer into the dictionaries. Removals run first
+// so that a file can replace a term's weight by removing and redefining it.
+func apply(layer *fileLexicon, positive, negative map[string]float64) {
+	for _, term := range layer.Remove {
+		term = services.NormalizeTerm(term)
+		delete(positive, term)
+		delete(negative, term)
+	}
+
+	set := func(term string, weight float64) {
+		term = services.NormalizeTerm(term)
+		if term == "" {
+			return
+		}
+		// A term lives in exactly one dictionary
+		delete(positive, term)
+		delete(negative, term)
+		if weight > 0 {
+			positive[term] = weight
+		} else {
+			negative[term] = weight
+		}
+	}
+
+	for term, weight := range layer.Positive {
+		set(term, weight)
+	}
+	for term, weight := range layer.Negative {
+		set(term, weight)
+	}
+	for term, weight := range layer.Terms {
+		set(term, weight)
+	}
+}
+
+func copyTerms(terms map[string]float64) map[string]float64 {
+	copied := make(map[string]float64, len(terms))
+	for term, weight := range terms {
+		copied[term] = weight
+	}
+	return copied
+}
+
+func without(terms []string, term string) []string {
+	var result []string
+	for _, existing := range terms {
+		if existing != term {
+			result = append(result, existing)
+		}
+	}
+	return result
+}
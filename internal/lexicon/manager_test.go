@@ -0,0 +1,187 @@
+package lexicon
+
+import (
+	"crypto-sentiment/internal/services"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// weight returns the weight of term in the active dictionary, or 0
+func weight(m *Manager, term string) float64 {
+	current := m.Current()
+	if w, ok := current.Positive[term]; ok {
+		return w
+	}
+	return current.Negative[term]
+}
+
+func TestLoadLayersFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "10-base.yaml", "positive:\n  pump: 1\n  hodl: 0.5\nremove:\n  - moon\n")
+	writeFile(t, dir, "20-later.csv", "pump,-2\n")
+	writeFile(t, dir, OverridesFile, `{"terms": {"hodl": 2}}`)
+	m := NewManager(dir, services.NewSentimentAnalyzer())
+
+	if w := weight(m, "moon"); w == 0 {
+		t.Fatal("built-in dictionary lacks moon")
+	}
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	current := m.Current()
+	if current.Version != 2 || current.Source != "files" {
+		t.Errorf("Current() = version %d from %s, want version 2 from files", current.Version, current.Source)
+	}
+	if _, ok := current.Positive["pump"]; ok {
+		t.Error("pump stayed positive after a later file made it negative")
+	}
+	if w := current.Negative["pump"]; w != -2 {
+		t.Errorf("pump = %v, want -2 from the later file", w)
+	}
+	if w := weight(m, "hodl"); w != 2 {
+		t.Errorf("hodl = %v, want 2 from the overrides", w)
+	}
+	if w := weight(m, "moon"); w != 0 {
+		t.Errorf("moon = %v, want it removed", w)
+	}
+
+	// Reloading unchanged files doesn't record a version
+	if err := m.Load(); err != nil {
+		t.Fatalf("second Load() error = %v", err)
+	}
+	if n := len(m.Versions()); n != 2 {
+		t.Errorf("len(Versions()) = %d, want 2", n)
+	}
+}
+
+func TestLoadMalformedFileKeepsDictionary(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, OverridesFile, `{"terms": {"pump": 1}}`)
+	m := NewManager(dir, services.NewSentimentAnalyzer())
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	writeFile(t, dir, "broken.json", `{"terms": `)
+	if err := m.Load(); err == nil {
+		t.Fatal("Load() with a malformed file succeeded")
+	}
+	if current := m.Current(); current.Version != 2 || current.Positive["pump"] != 1 {
+		t.Errorf("Current() = version %d with pump %v, want version 2 kept", current.Version, current.Positive["pump"])
+	}
+}
+
+func TestApplySetsAndRemovesTerms(t *testing.T) {
+	dir := t.TempDir()
+	analyzer := services.NewSentimentAnalyzer()
+	m := NewManager(dir, analyzer)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	dictionary, err := m.Apply(Patch{Set: map[string]float64{"Rug Pull": -3, "wagmi": 1.5}})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if dictionary.Source != "patch" || dictionary.Negative["rug pull"] != -3 || dictionary.Positive["wagmi"] != 1.5 {
+		t.Errorf("Apply() = %+v, want rug pull and wagmi set by a patch", dictionary)
+	}
+	if positive, _ := analyzer.Dictionaries(); positive["wagmi"] != 1.5 {
+		t.Error("analyzer lacks the patched term")
+	}
+
+	if _, err := m.Apply(Patch{Remove: []string{"wagmi", "moon"}}); err != nil {
+		t.Fatalf("Apply() removal error = %v", err)
+	}
+	for _, term := range []string{"wagmi", "moon"} {
+		if w := weight(m, term); w != 0 {
+			t.Errorf("%s = %v after removal, want it gone", term, w)
+		}
+	}
+
+	// The overrides survive a restart
+	restarted := NewManager(dir, services.NewSentimentAnalyzer())
+	if err := restarted.Load(); err != nil {
+		t.Fatalf("Load() after restart error = %v", err)
+	}
+	if w := weight(restarted, "rug pull"); w != -3 {
+		t.Errorf("rug pull = %v after restart, want -3", w)
+	}
+	if w := weight(restarted, "moon"); w != 0 {
+		t.Errorf("moon = %v after restart, want it removed", w)
+	}
+}
+
+func TestApplyInMemory(t *testing.T) {
+	m := NewManager("", services.NewSentimentAnalyzer())
+	if _, err := m.Apply(Patch{Set: map[string]float64{"wagmi": 1}}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if _, err := m.Apply(Patch{Set: map[string]float64{"ngmi": -1}}); err != nil {
+		t.Fatalf("second Apply() error = %v", err)
+	}
+	if weight(m, "wagmi") != 1 || weight(m, "ngmi") != -1 {
+		t.Error("in-memory overrides lost a patch")
+	}
+}
+
+func TestApplyRejectsInvalidWeight(t *testing.T) {
+	m := NewManager("", services.NewSentimentAnalyzer())
+	if _, err := m.Apply(Patch{Set: map[string]float64{"wagmi": 9}}); err == nil {
+		t.Error("Apply() accepted a weight beyond the maximum")
+	}
+	if n := len(m.Versions()); n != 1 {
+		t.Errorf("len(Versions()) = %d, want only the built-in version", n)
+	}
+}
+
+func TestApplyMalformedFileKeepsNothing(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(dir, services.NewSentimentAnalyzer())
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	broken := writeFile(t, dir, "broken.yaml", "positive: [")
+	if _, err := m.Apply(Patch{Set: map[string]float64{"wagmi": 1}}); err == nil {
+		t.Fatal("Apply() with a malformed lexicon file succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, OverridesFile)); !os.IsNotExist(err) {
+		t.Errorf("overrides were saved for a failed patch: %v", err)
+	}
+
+	// Once the file is fixed, the failed patch doesn't come back
+	if err := os.Remove(broken); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if w := weight(m, "wagmi"); w != 0 {
+		t.Errorf("wagmi = %v, want the failed patch dropped", w)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	m := NewManager("", services.NewSentimentAnalyzer())
+	if _, err := m.Apply(Patch{Set: map[string]float64{"wagmi": 1}}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	dictionary, err := m.Rollback(1)
+	if err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if dictionary.Version != 3 || dictionary.Source != "rollback to 1" {
+		t.Errorf("Rollback() = version %d from %s, want version 3 from rollback to 1", dictionary.Version, dictionary.Source)
+	}
+	if w := weight(m, "wagmi"); w != 0 {
+		t.Errorf("wagmi = %v after rolling back to the built-in version", w)
+	}
+
+	if _, err := m.Rollback(42); err == nil {
+		t.Error("Rollback() to a version never recorded succeeded")
+	}
+}
@@ -0,0 +1,428 @@
+package mockupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tokens issued by the mock token endpoints. API requests carrying any
+// other token are rejected with 401.
+const (
+	RedditToken  = "mock-reddit-token"
+	TwitterToken = "mock-twitter-token"
+)
+
+// Fixture names. A file <name>.json in the fixture directory is served
+// verbatim instead of the generated response, so that recorded upstream
+// responses can be replayed.
+const (
+	RedditSearchFixture   = "reddit_search"
+	RedditCommentsFixture = "reddit_comments"
+	TwitterSearchFixture  = "twitter_search"
+	CoinGeckoPriceFixture = "coingecko_price"
+)
+
+// templates are the generated posts; %s is the first search term
+var templates = []string{
+	"%s looking very bullish, breakout incoming 🚀",
+	"Not sure about %s, feels like a dump is coming",
+	"%s holding support nicely, buy the dip",
+	"Sold my %s at a loss. Bearish until the bear market ends 📉",
+	"%s to the moon! Diamond hands 💎🙌",
+	"Anyone else watching %s today?",
+	"%s volume is weak, slight decline expected",
+	"%s just hit a new all time high 📈",
+}
+
+// maxWebhooks is how many received webhook requests the sink keeps
+const maxWebhooks = 100
+
+// Server answers the Reddit, Twitter and CoinGecko endpoints used by the
+// services, so every base URL can point at the same mock host. It also
+// serves /webhook, a sink for alert deliveries.
+type Server struct {
+	fixtureDir string
+	mux        *http.ServeMux
+
+	webhookMutex sync.Mutex
+	webhooks     []Webhook
+}
+
+// Webhook is a request received by the webhook sink
+type Webhook struct {
+	ReceivedAt time.Time         `json:"received_at"`
+	Headers    map[string]string `json:"headers"`
+	Body       json.RawMessage   `json:"body"`
+	Status     int               `json:"status"`
+}
+
+// NewServer creates a mock upstream. fixtureDir may be empty to always
+// serve generated responses.
+func NewServer(fixtureDir string) *Server {
+	s := &Server{
+		fixtureDir: fixtureDir,
+		mux:        http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/api/v1/access_token", s.redditToken)
+	s.mux.HandleFunc("/r/", s.redditListing)
+	s.mux.HandleFunc("/comments/", s.redditComments)
+	s.mux.HandleFunc("/oauth2/token", s.twitterToken)
+	s.mux.HandleFunc("/2/tweets/search/recent", s.twitterSearch)
+	s.mux.HandleFunc("/api/v3/simple/price", s.coinGeckoPrice)
+	s.mux.HandleFunc("/webhook", s.webhook)
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("mock upstream: %s %s", r.Method, r.URL.RequestURI())
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) redditToken(w http.ResponseWriter, r *http.Request) {
+	if !hasBasicAuth(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": RedditToken,
+		"token_type":   "bearer",
+		"expires_in":   3600,
+	})
+}
+
+func (s *Server) twitterToken(w http.ResponseWriter, r *http.Request) {
+	if !hasBasicAuth(r) {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{
+			"errors": []map[string]string{{"message": "Unable to verify your credentials"}},
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"token_type":   "bearer",
+		"access_token": TwitterToken,
+	})
+}
+
+// redditListing serves /r/<subreddit>/search.json and /r/<subreddit>/new.json
+// in two pages, the second one reached through the after cursor
+func (s *Server) redditListing(w http.ResponseWriter, r *http.Request) {
+	if !s.redditAuthorized(w, r) {
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/r/")
+	subreddit, listing, ok := strings.Cut(path, "/")
+	if !ok || (listing != "search.json" && listing != "new.json") {
+		http.NotFound(w, r)
+		return
+	}
+	if s.serveFixture(w, RedditSearchFixture) {
+		return
+	}
+
+	term := subreddit
+	if listing == "search.json" {
+		term = firstTerm(r.URL.Query().Get("q"))
+	}
+
+	// Each page holds half of the templates
+	half := len(templates) / 2
+	first, after := 0, "t3_page2"
+	if r.URL.Query().Get("after") != "" {
+		first, after = half, ""
+	}
+
+	type child struct {
+		Kind string                 `json:"kind"`
+		Data map[string]interface{} `json:"data"`
+	}
+	children := make([]child, 0, half)
+	for i := first; i < first+half; i++ {
+		text := fmt.Sprintf(templates[i], term)
+		children = append(children, child{Kind: "t3", Data: map[string]interface{}{
+			"id":           postID(subreddit, term, i),
+			"title":        text,
+			"selftext":     "",
+			"score":        int(hash(text) % 500),
+			"num_comments": int(hash(text) % 40),
+			"created_utc":  float64(time.Now().Add(-time.Duration(i) * 10 * time.Minute).Unix()),
+			"subreddit":    subreddit,
+		}})
+	}
+
+	var cursor interface{}
+	if after != "" {
+		cursor = after
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"kind": "Listing",
+		"data": map[string]interface{}{"children": children, "after": cursor},
+	})
+}
+
+// redditComments serves /comments/<id>.json with a small comment tree
+func (s *Server) redditComments(w http.ResponseWriter, r *http.Request) {
+	if !s.redditAuthorized(w, r) {
+		return
+	}
+	if s.serveFixture(w, RedditCommentsFixture) {
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/comments/"), ".json")
+	comment := func(i int, body string, replies interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"kind": "t1",
+			"data": map[string]interface{}{
+				"id":          postID("comment", id, i),
+				"body":        body,
+				"score":       int(hash(body+id) % 100),
+				"created_utc": float64(time.Now().Add(-time.Duration(i) * time.Minute).Unix()),
+				"replies":     replies,
+			},
+		}
+	}
+	listing := func(children ...interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"kind": "Listing",
+			"data": map[string]interface{}{"children": children, "after": nil},
+		}
+	}
+
+	tree := listing(
+		comment(0, "This is the breakout we were waiting for, bullish", listing(
+			comment(1, "Not bullish at all, looks like a dead cat bounce", ""),
+			comment(2, "[deleted]", ""),
+		)),
+		comment(3, "Taking profit here, strong gains this week", ""),
+		map[string]interface{}{"kind": "more", "data": map[string]interface{}{"count": 12}},
+	)
+	writeJSON(w, http.StatusOK, []interface{}{listing(), tree})
+}
+
+// redditAuthorized rejects requests without the mock token and sets
+// Reddit's rate limit headers on the others
+func (s *Server) redditAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") != "Bearer "+RedditToken {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Unauthorized"})
+		return false
+	}
+
+	w.Header().Set("X-Ratelimit-Remaining", "599.0")
+	w.Header().Set("X-Ratelimit-Used", "1")
+	w.Header().Set("X-Ratelimit-Reset", "600")
+	return true
+}
+
+func (s *Server) twitterSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+TwitterToken {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"title": "Unauthorized", "status": 401,
+		})
+		return
+	}
+
+	w.Header().Set("x-rate-limit-limit", "450")
+	w.Header().Set("x-rate-limit-remaining", "449")
+	w.Header().Set("x-rate-limit-reset", strconv.FormatInt(time.Now().Add(15*time.Minute).Unix(), 10))
+	if s.serveFixture(w, TwitterSearchFixture) {
+		return
+	}
+
+	// Tweet ids grow with time, so a since_id request only gets tweets
+	// posted in later minutes
+	query := r.URL.Query()
+	term := firstTerm(query.Get("query"))
+	minute := time.Now().Unix() / 60
+	sinceID, _ := strconv.ParseInt(query.Get("since_id"), 10, 64)
+
+	// Each page holds half of the templates
+	half := len(templates) / 2
+	first, next := 0, "page2"
+	if query.Get("next_token") != "" {
+		first, next = half, ""
+	}
+
+	var (
+		data  []map[string]interface{}
+		users []map[string]interface{}
+	)
+	for i := first; i < first+half; i++ {
+		id := (minute-int64(i))*100 + int64(hash(term)%100)
+		if id <= sinceID {
+			continue
+		}
+		text := fmt.Sprintf(templates[i], term)
+		authorID := strconv.Itoa(1000 + i)
+		data = append(data, map[string]interface{}{
+			"id":         strconv.FormatInt(id, 10),
+			"text":       text,
+			"author_id":  authorID,
+			"created_at": time.Unix((minute-int64(i))*60, 0).UTC().Format(time.RFC3339),
+			"public_metrics": map[string]int{
+				"like_count":    int(hash(text) % 200),
+				"retweet_count": int(hash(text) % 50),
+				"reply_count":   int(hash(text) % 20),
+				"quote_count":   int(hash(text) % 5),
+			},
+		})
+		users = append(users, map[string]interface{}{
+			"id":         authorID,
+			"username":   fmt.Sprintf("trader%d", i),
+			"created_at": time.Now().AddDate(0, 0, -i*90).UTC().Format(time.RFC3339),
+			"public_metrics": map[string]int{
+				"followers_count": i * i * 250,
+				"following_count": 300,
+				"tweet_count":     5000,
+			},
+		})
+	}
+
+	meta := map[string]interface{}{"result_count": len(data)}
+	if len(data) > 0 {
+		meta["newest_id"] = data[0]["id"]
+		if next != "" {
+			meta["next_token"] = next
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":     data,
+		"includes": map[string]interface{}{"users": users},
+		"meta":     meta,
+	})
+}
+
+// coinGeckoPrice answers /api/v3/simple/price with a stable made-up price
+// for every requested id
+func (s *Server) coinGeckoPrice(w http.ResponseWriter, r *http.Request) {
+	if s.serveFixture(w, CoinGeckoPriceFixture) {
+		return
+	}
+
+	result := make(map[string]map[string]float64)
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id == "" {
+			continue
+		}
+		h := hash(id)
+		price := float64(h%100000)/100 + 1
+		result[id] = map[string]float64{
+			"usd":            price,
+			"usd_24h_change": float64(int64(h%2000)-1000) / 100,
+			"usd_market_cap": price * 1e7,
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// webhook records POST requests and answers them with ?status= (default
+// 200), so that failing receivers can be simulated. GET lists the recorded
+// requests, newest last; DELETE clears them.
+func (s *Server) webhook(w http.ResponseWriter, r *http.Request) {
+	s.webhookMutex.Lock()
+	defer s.webhookMutex.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"webhooks": s.webhooks})
+	case http.MethodDelete:
+		s.webhooks = nil
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPost:
+		status := http.StatusOK
+		if value := r.URL.Query().Get("status"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 100 || parsed > 599 {
+				http.Error(w, "invalid status", http.StatusBadRequest)
+				return
+			}
+			status = parsed
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil || !json.Valid(body) {
+			http.Error(w, "body must be JSON", http.StatusBadRequest)
+			return
+		}
+		headers := make(map[string]string)
+		for name := range r.Header {
+			headers[name] = r.Header.Get(name)
+		}
+
+		s.webhooks = append(s.webhooks, Webhook{
+			ReceivedAt: time.Now(),
+			Headers:    headers,
+			Body:       body,
+			Status:     status,
+		})
+		if len(s.webhooks) > maxWebhooks {
+			s.webhooks = s.webhooks[len(s.webhooks)-maxWebhooks:]
+		}
+		writeJSON(w, status, map[string]interface{}{"received": true})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveFixture writes the named fixture if the directory has one
+func (s *Server) serveFixture(w http.ResponseWriter, name string) bool {
+	if s.fixtureDir == "" {
+		return false
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.fixtureDir, name+".json"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("mock upstream: error reading fixture %s: %v", name, err)
+		}
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+	return true
+}
+
+// hasBasicAuth accepts any non-empty client credentials
+func hasBasicAuth(r *http.Request) bool {
+	user, _, ok := r.BasicAuth()
+	return ok && user != ""
+}
+
+// firstTerm extracts the first search term from a Reddit or Twitter query
+// such as `(BTC OR Bitcoin) -is:retweet`
+func firstTerm(query string) string {
+	fields := strings.Fields(strings.NewReplacer("(", " ", ")", " ", `"`, " ").Replace(query))
+	if len(fields) == 0 {
+		return "crypto"
+	}
+	return fields[0]
+}
+
+func postID(scope, term string, i int) string {
+	return strconv.FormatUint(uint64(hash(fmt.Sprintf("%s/%s/%d", scope, term, i))), 36)
+}
+
+func hash(value string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return h.Sum32()
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Alert conditions. The score conditions compare the overall score with
+// Threshold. change_above fires when the score moved by more than
+// Threshold, in either direction, since the first result within Window.
+// volume_spike fires when the post count reaches Threshold times its
+// average over Window.
+const (
+	ConditionScoreBelow  = "score_below"
+	ConditionScoreAbove  = "score_above"
+	ConditionChangeAbove = "change_above"
+	ConditionVolumeSpike = "volume_spike"
+)
+
+// AlertRule is a condition on the sentiment of one symbol and the webhook
+// notified when it is met. Secret signs the deliveries.
+type AlertRule struct {
+	ID          int64      `json:"id"`
+	Symbol      string     `json:"symbol"`
+	Condition   string     `json:"condition"`
+	Threshold   float64    `json:"threshold"`
+	Window      Duration   `json:"window,omitempty"`
+	Cooldown    Duration   `json:"cooldown"`
+	WebhookURL  string     `json:"webhook_url"`
+	Secret      string     `json:"secret,omitempty"`
+	Enabled     bool       `json:"enabled"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastFiredAt *time.Time `json:"last_fired_at,omitempty"`
+}
+
+// Delivery statuses of an alert event
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// AlertEvent records one firing of a rule and the delivery of its webhook.
+// Value is the measurement that met the condition.
+type AlertEvent struct {
+	ID          int64      `json:"id"`
+	RuleID      int64      `json:"rule_id"`
+	Symbol      string     `json:"symbol"`
+	SentimentID int64      `json:"sentiment_id,omitempty"`
+	Value       float64    `json:"value"`
+	Message     string     `json:"message"`
+	FiredAt     time.Time  `json:"fired_at"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// Duration is a time.Duration written to and read from JSON as a string
+// such as "1h30m"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1h\"")
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -27,3 +27,21 @@ type MarketData struct {
 	MarketCap      CoinPrice `json:"market_cap"`
 	Volume24h      CoinPrice `json:"total_volume"`
 }
+
+// PriceData is one stored price sample for a symbol
+type PriceData struct {
+	ID             int64     `json:"id"`
+	Symbol         string    `json:"symbol"`
+	Price          float64   `json:"price"`
+	PriceChange24h float64   `json:"price_change_24h"`
+	MarketCap      float64   `json:"market_cap"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// PriceHistoryPoint is the average price of all PriceData rows that fall
+// into one time bucket
+type PriceHistoryPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Price     float64   `json:"price"`
+	Samples   int       `json:"samples"`
+}
@@ -3,18 +3,93 @@ package models
 import "time"
 
 type SentimentData struct {
-	ID        int64     `json:"id"`
-	Symbol    string    `json:"symbol"`
+	ID          int64     `json:"id"`
+	Symbol      string    `json:"symbol"`
+	Score       float64   `json:"score"`
+	Reddit      float64   `json:"reddit_score"`
+	Twitter     *float64  `json:"twitter_score,omitempty"`
+	RedditPosts int       `json:"reddit_posts"`
+	Tweets      int       `json:"tweets"`
+	Posts       int       `json:"total_posts"`
+	Timestamp   time.Time `json:"timestamp"`
+	// Sources holds the per-platform breakdown keyed by source name
+	Sources map[string]SourceSentiment `json:"sources,omitempty"`
+	// Aggregation describes how the posts were combined into Score
+	Aggregation *AggregationInfo `json:"aggregation,omitempty"`
+	// AnalyzedPosts are the scored posts behind this result. They are
+	// stored separately and served by the posts endpoint.
+	AnalyzedPosts []SocialPost `json:"-"`
+}
+
+// Complete reports whether every enabled source delivered all of its data
+func (d *SentimentData) Complete() bool {
+	for _, source := range d.Sources {
+		if source.Status != SourceOK && source.Status != SourceDisabled {
+			return false
+		}
+	}
+	return true
+}
+
+// Source statuses. A degraded source delivered only part of its data, for
+// example because one of several requests failed.
+const (
+	SourceOK       = "ok"
+	SourceDegraded = "degraded"
+	SourceDisabled = "disabled"
+	SourceError    = "error"
+)
+
+// SourceSentiment is the sentiment computed from a single platform. Posts
+// counts everything fetched, Used only those that were aggregated. Reason
+// explains a status other than ok.
+type SourceSentiment struct {
+	Status              string  `json:"status"`
+	Reason              string  `json:"reason,omitempty"`
+	LatencyMS           int64   `json:"latency_ms"`
+	Score               float64 `json:"score"`
+	Posts               int     `json:"posts"`
+	Used                int     `json:"posts_used"`
+	EffectiveSampleSize float64 `json:"effective_sample_size"`
+}
+
+// Healthy reports whether the source delivered posts that count towards
+// the overall score
+func (s SourceSentiment) Healthy() bool {
+	return s.Status == SourceOK || s.Status == SourceDegraded
+}
+
+// AggregationInfo records the aggregation strategy behind a score
+type AggregationInfo struct {
+	Strategy            string  `json:"strategy"`
+	MinConfidence       float64 `json:"min_confidence"`
+	TrimFraction        float64 `json:"trim_fraction,omitempty"`
+	Used                int     `json:"posts_used"`
+	EffectiveSampleSize float64 `json:"effective_sample_size"`
+}
+
+// SentimentHistoryPoint is the average of all SentimentData rows that fall
+// into one time bucket. Posts is the total across those rows. The platform
+// scores average only the rows where that platform was healthy.
+type SentimentHistoryPoint struct {
+	Timestamp time.Time `json:"timestamp"`
 	Score     float64   `json:"score"`
-	Reddit    float64   `json:"reddit_score"`
-	Twitter   float64   `json:"twitter_score"`
+	Reddit    *float64  `json:"reddit_score,omitempty"`
+	Twitter   *float64  `json:"twitter_score,omitempty"`
 	Posts     int       `json:"total_posts"`
-	Timestamp time.Time `json:"timestamp"`
+	Samples   int       `json:"samples"`
 }
 
 type SocialPost struct {
-	Platform  string    `json:"platform"`
-	Content   string    `json:"content"`
-	Sentiment float64   `json:"sentiment_score"`
+	ID         string   `json:"id"`
+	Platform   string   `json:"platform"`
+	Content    string   `json:"content"`
+	Sentiment  float64  `json:"sentiment_score"`
+	Confidence float64  `json:"confidence"`
+	Keywords   []string `json:"keywords"`
+	// Engagement is the platform's interaction count, e.g. Reddit upvotes
+	Engagement float64 `json:"engagement"`
+	// Reach is the author's audience, e.g. Twitter followers, where known
+	Reach     float64   `json:"reach"`
 	CreatedAt time.Time `json:"created_at"`
 }
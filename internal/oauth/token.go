@@ -0,0 +1,186 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRefreshMargin is how long before expiry a token is refreshed
+const defaultRefreshMargin = time.Minute
+
+// Config describes a client credentials grant
+type Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	// UserAgent is sent with token requests when set; Reddit rejects
+	// requests without one
+	UserAgent string
+	// RefreshMargin defaults to one minute
+	RefreshMargin time.Duration
+}
+
+// TokenSource caches an access token obtained with the client credentials
+// grant. A token is refreshed in the background once it is within
+// RefreshMargin of expiring, and callers only block when there is no
+// usable token at all. Concurrent refreshes are collapsed into one request.
+type TokenSource struct {
+	config     Config
+	httpClient *http.Client
+	// now is replaceable so that expiry can be tested without waiting
+	now func() time.Time
+
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time
+	flight *flight
+}
+
+// flight is a token request shared by every caller waiting on it
+type flight struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// NewTokenSource creates a token source. httpClient is used for token
+// requests only and defaults to a client with a 10 second timeout.
+func NewTokenSource(config Config, httpClient *http.Client) *TokenSource {
+	if config.RefreshMargin <= 0 {
+		config.RefreshMargin = defaultRefreshMargin
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &TokenSource{
+		config:     config,
+		httpClient: httpClient,
+		now:        time.Now,
+	}
+}
+
+// Token returns a valid access token, requesting one if needed
+func (ts *TokenSource) Token(ctx context.Context) (string, error) {
+	ts.mutex.Lock()
+	now := ts.now()
+	if ts.token != "" && (ts.expiry.IsZero() || now.Before(ts.expiry)) {
+		token := ts.token
+		// Refresh ahead of expiry while the current token is still served
+		if !ts.expiry.IsZero() && now.After(ts.expiry.Add(-ts.config.RefreshMargin)) {
+			ts.startRefresh()
+		}
+		ts.mutex.Unlock()
+		return token, nil
+	}
+	f := ts.startRefresh()
+	ts.mutex.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Invalidate discards token if it is still the cached one, typically after
+// the API rejected it. The next Token call fetches a new one.
+func (ts *TokenSource) Invalidate(token string) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	if ts.token == token {
+		ts.token = ""
+		ts.expiry = time.Time{}
+	}
+}
+
+// startRefresh joins the refresh in progress or starts a new one. Must be
+// called with the mutex held.
+func (ts *TokenSource) startRefresh() *flight {
+	if ts.flight != nil {
+		return ts.flight
+	}
+
+	f := &flight{done: make(chan struct{})}
+	ts.flight = f
+
+	// The request is not tied to any caller's context so that one caller
+	// giving up doesn't fail everyone else waiting on the same token
+	go func() {
+		token, expiresIn, err := ts.fetch()
+
+		ts.mutex.Lock()
+		if err == nil {
+			ts.token = token
+			ts.expiry = time.Time{}
+			if expiresIn > 0 {
+				ts.expiry = ts.now().Add(expiresIn)
+			}
+		}
+		ts.flight = nil
+		ts.mutex.Unlock()
+
+		f.token, f.err = token, err
+		close(f.done)
+	}()
+	return f
+}
+
+// fetch requests a new token. A zero expiresIn means the token does not
+// expire, as with Twitter's app-only bearer tokens.
+func (ts *TokenSource) fetch() (string, time.Duration, error) {
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+
+	req, err := http.NewRequest("POST", ts.config.TokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+
+	req.SetBasicAuth(url.QueryEscape(ts.config.ClientID), url.QueryEscape(ts.config.ClientSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+	if ts.config.UserAgent != "" {
+		req.Header.Set("User-Agent", ts.config.UserAgent)
+	}
+
+	resp, err := ts.httpClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&result)
+
+	if resp.StatusCode != http.StatusOK {
+		if result.Error != "" {
+			return "", 0, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, result.Error)
+		}
+		return "", 0, fmt.Errorf("token request failed with status %d", resp.StatusCode)
+	}
+	if decodeErr != nil {
+		return "", 0, fmt.Errorf("error decoding token response: %v", decodeErr)
+	}
+	// Reddit answers bad credentials with 200 and an error body
+	if result.AccessToken == "" {
+		if result.Error != "" {
+			return "", 0, fmt.Errorf("token request failed: %s", result.Error)
+		}
+		return "", 0, fmt.Errorf("token response contained no access token")
+	}
+
+	return result.AccessToken, time.Duration(result.ExpiresIn) * time.Second, nil
+}
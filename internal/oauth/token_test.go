@@ -0,0 +1,213 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenServer issues token-1, token-2, ... with the given lifetime,
+// waiting on release first when it is set
+type tokenServer struct {
+	*httptest.Server
+	requests  atomic.Int32
+	expiresIn int
+	release   chan struct{}
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	ts := &tokenServer{expiresIn: expiresIn}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := ts.requests.Add(1)
+		if ts.release != nil {
+			<-ts.release
+		}
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "client_credentials" {
+			http.Error(w, `{"error": "unsupported_grant_type"}`, http.StatusBadRequest)
+			return
+		}
+		if id, secret, ok := r.BasicAuth(); !ok || id != "id" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": "invalid_client"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "bearer", "expires_in": %d}`, n, ts.expiresIn)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// clock is a settable time source
+type clock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newSource(server *tokenServer, c *clock) *TokenSource {
+	source := NewTokenSource(Config{TokenURL: server.URL, ClientID: "id", ClientSecret: "secret"}, server.Client())
+	if c != nil {
+		source.now = c.Now
+	}
+	return source
+}
+
+// waitFor polls until cond holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTokenSourceCachesToken(t *testing.T) {
+	server := newTokenServer(t, 3600)
+	source := newSource(server, nil)
+
+	for i := 0; i < 3; i++ {
+		token, err := source.Token(context.Background())
+		if err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+		if token != "token-1" {
+			t.Errorf("Token() = %q, want token-1", token)
+		}
+	}
+	if n := server.requests.Load(); n != 1 {
+		t.Errorf("token requests = %d, want 1", n)
+	}
+}
+
+func TestTokenSourceRefreshesBeforeExpiry(t *testing.T) {
+	server := newTokenServer(t, 3600)
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	source := newSource(server, c)
+
+	if token, _ := source.Token(context.Background()); token != "token-1" {
+		t.Fatalf("Token() = %q, want token-1", token)
+	}
+
+	// Outside the refresh margin nothing is requested
+	c.Advance(58 * time.Minute)
+	if token, _ := source.Token(context.Background()); token != "token-1" {
+		t.Errorf("Token() = %q, want token-1", token)
+	}
+	if n := server.requests.Load(); n != 1 {
+		t.Errorf("token requests = %d, want 1", n)
+	}
+
+	// Within the margin the current token is served while a new one is
+	// fetched in the background
+	c.Advance(90 * time.Second)
+	if token, _ := source.Token(context.Background()); token != "token-1" {
+		t.Errorf("Token() within the margin = %q, want token-1", token)
+	}
+	waitFor(t, func() bool {
+		token, _ := source.Token(context.Background())
+		return token == "token-2"
+	})
+	if n := server.requests.Load(); n != 2 {
+		t.Errorf("token requests = %d, want 2", n)
+	}
+}
+
+func TestTokenSourceBlocksOnExpiredToken(t *testing.T) {
+	server := newTokenServer(t, 60)
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	source := newSource(server, c)
+	source.config.RefreshMargin = time.Second
+
+	source.Token(context.Background())
+	c.Advance(2 * time.Minute)
+
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if token != "token-2" {
+		t.Errorf("Token() after expiry = %q, want token-2", token)
+	}
+}
+
+func TestTokenSourceSingleFlight(t *testing.T) {
+	server := newTokenServer(t, 3600)
+	server.release = make(chan struct{})
+	source := newSource(server, nil)
+
+	const callers = 10
+	tokens := make([]string, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = source.Token(context.Background())
+		}(i)
+	}
+
+	waitFor(t, func() bool { return server.requests.Load() == 1 })
+	close(server.release)
+	wg.Wait()
+
+	for i := range tokens {
+		if errs[i] != nil || tokens[i] != "token-1" {
+			t.Errorf("caller %d got (%q, %v), want token-1", i, tokens[i], errs[i])
+		}
+	}
+	if n := server.requests.Load(); n != 1 {
+		t.Errorf("token requests = %d, want 1", n)
+	}
+}
+
+func TestTokenSourceCallerCancel(t *testing.T) {
+	server := newTokenServer(t, 3600)
+	server.release = make(chan struct{})
+	source := newSource(server, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := source.Token(ctx); err != context.Canceled {
+		t.Errorf("Token() with a cancelled context error = %v, want context.Canceled", err)
+	}
+
+	// The shared request carries on for the callers still waiting
+	close(server.release)
+	token, err := source.Token(context.Background())
+	if err != nil || token != "token-1" {
+		t.Errorf("Token() = (%q, %v), want token-1", token, err)
+	}
+}
+
+func TestTokenSourceError(t *testing.T) {
+	server := newTokenServer(t, 3600)
+	source := NewTokenSource(Config{TokenURL: server.URL, ClientID: "id", ClientSecret: "wrong"}, server.Client())
+
+	_, err := source.Token(context.Background())
+	if err == nil {
+		t.Fatal("Token() with bad credentials succeeded")
+	}
+	if want := "token request failed with status 401: invalid_client"; err.Error() != want {
+		t.Errorf("Token() error = %q, want %q", err, want)
+	}
+}
@@ -0,0 +1,93 @@
+package oauth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// apiServer accepts only the given token and echoes request bodies
+func apiServer(t *testing.T, valid string, requests *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTransportRetriesOn401(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	var requests atomic.Int32
+	api := apiServer(t, "token-2", &requests)
+	client := &http.Client{Transport: &Transport{Source: newSource(tokens, nil)}}
+
+	resp, err := client.Post(api.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if string(body) != "payload" {
+		t.Errorf("body = %q, want the replayed payload", body)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("API requests = %d, want 2", n)
+	}
+	if n := tokens.requests.Load(); n != 2 {
+		t.Errorf("token requests = %d, want 2", n)
+	}
+}
+
+func TestTransportRetriesOnce(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	var requests atomic.Int32
+	api := apiServer(t, "never", &requests)
+	client := &http.Client{Transport: &Transport{Source: newSource(tokens, nil)}}
+
+	resp, err := client.Get(api.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", resp.StatusCode)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("API requests = %d, want 2", n)
+	}
+}
+
+func TestTransportSkipsRetryWithoutReplayableBody(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	var requests atomic.Int32
+	api := apiServer(t, "token-2", &requests)
+	client := &http.Client{Transport: &Transport{Source: newSource(tokens, nil)}}
+
+	// Wrapping the reader hides it from http.NewRequest, leaving GetBody nil
+	req, _ := http.NewRequest("POST", api.URL, io.NopCloser(strings.NewReader("payload")))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", resp.StatusCode)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("API requests = %d, want 1", n)
+	}
+}
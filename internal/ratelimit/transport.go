@@ -0,0 +1,358 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// resetTolerance absorbs the drift of resets reported in relative seconds,
+// which move with the time each response is received
+const resetTolerance = time.Second
+
+// Config tunes the retry and cooldown behaviour of a Transport
+type Config struct {
+	// MaxRetries is how many times a throttled or failed request is
+	// retried
+	MaxRetries int
+	// BaseBackoff is the delay before the first retry; it doubles with
+	// every further attempt up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// MaxWait is the longest a request waits for a host to come out of
+	// cooldown. Longer cooldowns fail the request with a CooldownError.
+	MaxWait time.Duration
+	// Reserve is how many requests of a host's quota are left unused, so
+	// that a burst never exhausts it completely
+	Reserve int
+}
+
+// DefaultConfig retries three times starting at half a second and waits
+// up to five seconds for a cooldown
+func DefaultConfig() Config {
+	return Config{
+		MaxRetries:  3,
+		BaseBackoff: 500 * time.Millisecond,
+		MaxBackoff:  30 * time.Second,
+		MaxWait:     5 * time.Second,
+		Reserve:     1,
+	}
+}
+
+// CooldownError is returned without contacting a host that is throttled
+// for longer than MaxWait
+type CooldownError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("%s is rate limited until %s", e.Host, e.Until.Format(time.RFC3339))
+}
+
+// HostStatus is the quota last reported by a host
+type HostStatus struct {
+	Host string `json:"host"`
+	// Remaining is nil until the host has reported a quota
+	Remaining     *int       `json:"remaining,omitempty"`
+	ResetAt       *time.Time `json:"reset_at,omitempty"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+	CoolingDown   bool       `json:"cooling_down"`
+	// Throttled counts the 429 responses received from the host
+	Throttled int `json:"throttled"`
+}
+
+// hostState is the quota tracked for one host
+type hostState struct {
+	remaining int
+	known     bool
+	// pending counts the requests let through that have not been answered
+	// yet, whose cost the last reported remaining does not reflect
+	pending       int
+	resetAt       time.Time
+	cooldownUntil time.Time
+	throttled     int
+}
+
+// Transport is an http.RoundTripper shared by every upstream client. It
+// tracks the quota each host reports in its rate limit headers, holds
+// requests back once the quota is spent until it resets, and retries 429
+// and 5xx responses with exponential backoff and jitter, honoring
+// Retry-After.
+type Transport struct {
+	base   http.RoundTripper
+	config Config
+
+	mutex sync.Mutex
+	hosts map[string]*hostState
+	rand  *rand.Rand
+}
+
+// NewTransport wraps base, which defaults to http.DefaultTransport
+func NewTransport(base http.RoundTripper, config Config) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		base:   base,
+		config: config,
+		hosts:  make(map[string]*hostState),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	host := req.URL.Host
+	// Requests with a body can only be retried if it can be replayed
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(ctx, host); err != nil {
+			return nil, err
+		}
+
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				// Release the quota reserved by wait
+				t.observe(host, nil)
+				return nil, err
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		t.observe(host, resp)
+		canRetry := replayable && attempt < t.config.MaxRetries
+		if err != nil {
+			if !canRetry || ctx.Err() != nil {
+				return nil, err
+			}
+			if err := sleep(ctx, t.backoff(attempt)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !retryable(resp.StatusCode) || !canRetry {
+			return resp, nil
+		}
+
+		delay := t.backoff(attempt)
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok && retryAfter > delay {
+			delay = retryAfter
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			t.cooldown(host, time.Now().Add(delay))
+		}
+		// Hand the throttled response back rather than block the caller
+		if delay > t.config.MaxWait {
+			return resp, nil
+		}
+
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Status reports every host seen so far, sorted by name
+func (t *Transport) Status() []HostStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	statuses := make([]HostStatus, 0, len(t.hosts))
+	for host, state := range t.hosts {
+		status := HostStatus{Host: host, Throttled: state.throttled}
+		if state.known {
+			remaining := state.remaining
+			status.Remaining = &remaining
+		}
+		if !state.resetAt.IsZero() {
+			resetAt := state.resetAt
+			status.ResetAt = &resetAt
+		}
+		if until := t.blockedUntil(state); until.After(now) {
+			status.CooldownUntil = &until
+			status.CoolingDown = true
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Host < statuses[j].Host
+	})
+	return statuses
+}
+
+// wait blocks until host may be contacted, or fails straight away when
+// that is further off than MaxWait. A request let through is counted
+// against the quota straight away, so that concurrent callers cannot all
+// pass on the same remaining count; observe settles it.
+func (t *Transport) wait(ctx context.Context, host string) error {
+	for {
+		t.mutex.Lock()
+		state := t.state(host)
+		until := t.blockedUntil(state)
+		delay := time.Until(until)
+		if delay <= 0 {
+			state.pending++
+			t.mutex.Unlock()
+			return nil
+		}
+		t.mutex.Unlock()
+
+		if delay > t.config.MaxWait {
+			return &CooldownError{Host: host, Until: until}
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// blockedUntil is when host may be contacted again, either after an
+// explicit cooldown or once a spent quota resets. Must be called with the
+// mutex held.
+func (t *Transport) blockedUntil(state *hostState) time.Time {
+	until := state.cooldownUntil
+	if state.known && state.remaining-state.pending <= t.config.Reserve && state.resetAt.After(until) {
+		until = state.resetAt
+	}
+	return until
+}
+
+func (t *Transport) cooldown(host string, until time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state := t.state(host)
+	if until.After(state.cooldownUntil) {
+		state.cooldownUntil = until
+	}
+}
+
+// observe settles the request counted by wait and records the quota
+// headers of resp, which is nil when the request failed. Reddit sends
+// X-Ratelimit-Remaining with the seconds until reset in
+// X-Ratelimit-Reset; Twitter sends x-rate-limit-remaining with the reset
+// as a Unix timestamp in x-rate-limit-reset.
+func (t *Transport) observe(host string, resp *http.Response) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state := t.state(host)
+	if state.pending > 0 {
+		state.pending--
+	}
+	if resp == nil {
+		return
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		state.throttled++
+	}
+
+	for _, prefix := range []string{"X-Ratelimit-", "X-Rate-Limit-"} {
+		remaining, err := strconv.ParseFloat(resp.Header.Get(prefix+"Remaining"), 64)
+		if err != nil {
+			continue
+		}
+		resetAt := state.resetAt
+		if reset, err := strconv.ParseFloat(resp.Header.Get(prefix+"Reset"), 64); err == nil {
+			resetAt = resetTime(reset)
+		}
+
+		// Within one window the quota only goes down, so a response that
+		// arrives after a later one cannot raise it again
+		sameWindow := state.known && resetAt.After(time.Now()) &&
+			!resetAt.After(state.resetAt.Add(resetTolerance))
+		if !sameWindow || int(math.Floor(remaining)) < state.remaining {
+			state.remaining = int(math.Floor(remaining))
+		}
+		state.resetAt = resetAt
+		state.known = true
+		return
+	}
+}
+
+// state returns the tracked state of host, creating it if needed. Must be
+// called with the mutex held.
+func (t *Transport) state(host string) *hostState {
+	state, ok := t.hosts[host]
+	if !ok {
+		state = &hostState{}
+		t.hosts[host] = state
+	}
+	return state
+}
+
+// backoff is the exponential delay before retry attempt+1 with up to 50%
+// jitter, so that concurrent callers don't retry in lockstep
+func (t *Transport) backoff(attempt int) time.Duration {
+	delay := t.config.BaseBackoff << uint(attempt)
+	if delay <= 0 || delay > t.config.MaxBackoff {
+		delay = t.config.MaxBackoff
+	}
+
+	t.mutex.Lock()
+	jitter := t.rand.Float64()
+	t.mutex.Unlock()
+	return delay/2 + time.Duration(jitter*float64(delay/2))
+}
+
+// retryable reports whether a status is worth retrying
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// resetTime interprets a reset header, which is either a delay in seconds
+// or a Unix timestamp depending on the API
+func resetTime(value float64) time.Time {
+	// No delay is anywhere near 30 years, so larger values are timestamps
+	if value > 1e9 {
+		return time.Unix(int64(value), 0)
+	}
+	return time.Now().Add(time.Duration(value * float64(time.Second)))
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an
+// HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
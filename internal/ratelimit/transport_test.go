@@ -0,0 +1,277 @@
+package ratelimit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		MaxRetries:  3,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+		MaxWait:     2 * time.Second,
+		Reserve:     1,
+	}
+}
+
+func get(t *testing.T, transport *Transport, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+func TestTransportHonorsRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+	transport := NewTransport(nil, testConfig())
+
+	start := time.Now()
+	resp, err := get(t, transport, server.URL)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least the 1s Retry-After", elapsed)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+
+	status := transport.Status()
+	if len(status) != 1 || status[0].Throttled != 1 {
+		t.Errorf("Status() = %+v, want one host throttled once", status)
+	}
+}
+
+func TestTransportCooldownBeyondMaxWait(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	transport := NewTransport(nil, testConfig())
+
+	// The throttled response is handed back rather than waited out
+	resp, err := get(t, transport, server.URL)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", resp.StatusCode)
+	}
+
+	// Later requests fail without contacting the host
+	_, err = get(t, transport, server.URL)
+	var cooldown *CooldownError
+	if !errors.As(err, &cooldown) {
+		t.Fatalf("RoundTrip() during cooldown error = %v, want a CooldownError", err)
+	}
+	if wait := time.Until(cooldown.Until); wait < 50*time.Second || wait > 60*time.Second {
+		t.Errorf("cooldown ends in %s, want about 60s", wait)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+	if status := transport.Status(); len(status) != 1 || !status[0].CoolingDown {
+		t.Errorf("Status() = %+v, want the host cooling down", status)
+	}
+}
+
+func TestTransportRetriesServerErrors(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	transport := NewTransport(nil, testConfig())
+
+	resp, err := get(t, transport, server.URL)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", resp.StatusCode)
+	}
+	if n := requests.Load(); n != 4 {
+		t.Errorf("requests = %d, want 1 plus 3 retries", n)
+	}
+}
+
+func TestTransportReleasesReservationWhenBodyFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	transport := NewTransport(nil, testConfig())
+
+	req, err := http.NewRequest("POST", server.URL, strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failure := errors.New("body gone")
+	req.GetBody = func() (io.ReadCloser, error) { return nil, failure }
+
+	if _, err := transport.RoundTrip(req); !errors.Is(err, failure) {
+		t.Fatalf("RoundTrip() error = %v, want %v", err, failure)
+	}
+	transport.mutex.Lock()
+	pending := transport.hosts[req.URL.Host].pending
+	transport.mutex.Unlock()
+	if pending != 0 {
+		t.Errorf("pending = %d, want the retry's reservation released", pending)
+	}
+}
+
+// quotaServer allows quota requests per window, reporting what is left in
+// Reddit's headers with the reset resetIn seconds away
+func quotaServer(quota int, resetIn string, delay time.Duration) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		time.Sleep(delay)
+		w.Header().Set("X-Ratelimit-Remaining", strconv.Itoa(max(quota-n, 0)))
+		w.Header().Set("X-Ratelimit-Reset", resetIn)
+		if n > quota {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	return server, &requests
+}
+
+func TestTransportReserveHoldsBackBurst(t *testing.T) {
+	server, requests := quotaServer(5, "60", 20*time.Millisecond)
+	defer server.Close()
+	config := testConfig()
+	config.MaxWait = 100 * time.Millisecond
+	transport := NewTransport(nil, config)
+
+	// Learn the quota: 4 remaining, of which 1 is the reserve
+	if _, err := get(t, transport, server.URL); err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+
+	const burst = 10
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		passed    int
+		cooldowns int
+	)
+	for i := 0; i < burst; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := get(t, transport, server.URL)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			var cooldown *CooldownError
+			switch {
+			case errors.As(err, &cooldown):
+				cooldowns++
+			case err == nil && resp.StatusCode == http.StatusOK:
+				passed++
+			default:
+				t.Errorf("RoundTrip() = %v, %v", resp, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if passed != 3 || cooldowns != burst-3 {
+		t.Errorf("passed %d and held back %d, want 3 and %d", passed, cooldowns, burst-3)
+	}
+	if n := requests.Load(); n != 4 {
+		t.Errorf("requests = %d, want 4 leaving the reserve unused", n)
+	}
+	status := transport.Status()
+	if len(status) != 1 || status[0].Remaining == nil || *status[0].Remaining != 1 {
+		t.Errorf("Status() = %+v, want 1 remaining", status)
+	}
+}
+
+func TestTransportReserveWaitsForReset(t *testing.T) {
+	// The quota is spent down to the reserve by the first request and
+	// resets 300ms later
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("X-Ratelimit-Remaining", "1")
+			w.Header().Set("X-Ratelimit-Reset", "0.3")
+			return
+		}
+		w.Header().Set("X-Ratelimit-Remaining", "9")
+		w.Header().Set("X-Ratelimit-Reset", "60")
+	}))
+	defer server.Close()
+	transport := NewTransport(nil, testConfig())
+
+	if _, err := get(t, transport, server.URL); err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+
+	start := time.Now()
+	if _, err := get(t, transport, server.URL); err != nil {
+		t.Fatalf("RoundTrip() after the reset error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("second request sent after %s, want it held until the reset", elapsed)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got, ok := parseRetryAfter(date); !ok || got < 59*time.Minute || got > time.Hour {
+		t.Errorf("parseRetryAfter(%q) = %v, %v, want about an hour", date, got, ok)
+	}
+}
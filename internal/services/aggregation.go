@@ -0,0 +1,117 @@
+package services
+
+import (
+	"crypto-sentiment/internal/models"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Aggregation strategies
+const (
+	StrategyMean       = "mean"
+	StrategyConfidence = "confidence"
+	StrategyEngagement = "engagement"
+	StrategyReach      = "reach"
+	StrategyTrimmed    = "trimmed"
+)
+
+// defaultTrimFraction is cut from each end by the trimmed mean
+const defaultTrimFraction = 0.1
+
+// Aggregator combines the scores of individual posts into one score
+type Aggregator struct {
+	// Strategy is one of the Strategy constants
+	Strategy string `json:"strategy"`
+	// MinConfidence drops posts analyzed with less confidence
+	MinConfidence float64 `json:"min_confidence"`
+	// TrimFraction is the share of posts dropped from each end by the
+	// trimmed mean
+	TrimFraction float64 `json:"trim_fraction,omitempty"`
+}
+
+// AggregateResult is the outcome of aggregating a set of posts
+type AggregateResult struct {
+	Score float64
+	// Used is how many posts passed the confidence filter and trimming
+	Used int
+	// EffectiveSampleSize is Kish's (Σw)²/Σw², which equals Used for
+	// unweighted strategies and shrinks as weights get more uneven
+	EffectiveSampleSize float64
+}
+
+// DefaultAggregator weights posts by confidence, so that posts without
+// any matched terms don't pull every score toward zero
+func DefaultAggregator() Aggregator {
+	return Aggregator{Strategy: StrategyConfidence}
+}
+
+// Validate checks the strategy and bounds, filling in the default trim
+// when TrimFraction is unset
+func (a *Aggregator) Validate() error {
+	switch a.Strategy {
+	case StrategyMean, StrategyConfidence, StrategyEngagement, StrategyReach:
+		a.TrimFraction = 0
+	case StrategyTrimmed:
+		if a.TrimFraction == 0 {
+			a.TrimFraction = defaultTrimFraction
+		}
+		if a.TrimFraction < 0 || a.TrimFraction >= 0.5 {
+			return fmt.Errorf("trim fraction must be in (0, 0.5)")
+		}
+	default:
+		return fmt.Errorf("unknown aggregation strategy %q", a.Strategy)
+	}
+
+	if a.MinConfidence < 0 || a.MinConfidence > 1 {
+		return fmt.Errorf("min confidence must be in [0, 1]")
+	}
+	return nil
+}
+
+// Aggregate combines the scores of posts according to the strategy
+func (a Aggregator) Aggregate(posts []models.SocialPost) AggregateResult {
+	var kept []models.SocialPost
+	for _, post := range posts {
+		if post.Confidence >= a.MinConfidence {
+			kept = append(kept, post)
+		}
+	}
+
+	if a.Strategy == StrategyTrimmed {
+		sort.SliceStable(kept, func(i, j int) bool {
+			return kept[i].Sentiment < kept[j].Sentiment
+		})
+		cut := int(float64(len(kept)) * a.TrimFraction)
+		kept = kept[cut : len(kept)-cut]
+	}
+
+	var sum, weightSum, squaredWeightSum float64
+	for _, post := range kept {
+		weight := a.weight(post)
+		sum += weight * post.Sentiment
+		weightSum += weight
+		squaredWeightSum += weight * weight
+	}
+
+	result := AggregateResult{Used: len(kept)}
+	if weightSum > 0 {
+		result.Score = sum / weightSum
+		result.EffectiveSampleSize = weightSum * weightSum / squaredWeightSum
+	}
+	return result
+}
+
+func (a Aggregator) weight(post models.SocialPost) float64 {
+	switch a.Strategy {
+	case StrategyConfidence:
+		return post.Confidence
+	case StrategyEngagement:
+		// Logarithmic so that one viral post doesn't drown out the rest
+		return 1 + math.Log1p(math.Max(post.Engagement, 0))
+	case StrategyReach:
+		return 1 + math.Log1p(math.Max(post.Reach, 0))
+	default:
+		return 1
+	}
+}
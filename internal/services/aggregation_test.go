@@ -0,0 +1,138 @@
+package services
+
+import (
+	"crypto-sentiment/internal/models"
+	"math"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	post := func(sentiment, confidence, engagement, reach float64) models.SocialPost {
+		return models.SocialPost{Sentiment: sentiment, Confidence: confidence, Engagement: engagement, Reach: reach}
+	}
+	// e-1 gives a logarithmic weight of exactly 2
+	const doubled = math.E - 1
+
+	tests := []struct {
+		name       string
+		aggregator Aggregator
+		posts      []models.SocialPost
+		score      float64
+		used       int
+		ess        float64
+	}{
+		{
+			name:       "mean",
+			aggregator: Aggregator{Strategy: StrategyMean},
+			posts:      []models.SocialPost{post(1, 0.1, 0, 0), post(-0.5, 0.9, 0, 0), post(0.2, 0.5, 0, 0)},
+			score:      0.7 / 3, used: 3, ess: 3,
+		},
+		{
+			name:       "confidence",
+			aggregator: Aggregator{Strategy: StrategyConfidence},
+			posts:      []models.SocialPost{post(1, 0.8, 0, 0), post(-1, 0.2, 0, 0)},
+			score:      0.6, used: 2, ess: 1 / 0.68,
+		},
+		{
+			name:       "confidence without any confident post",
+			aggregator: Aggregator{Strategy: StrategyConfidence},
+			posts:      []models.SocialPost{post(0, 0, 0, 0), post(0, 0, 0, 0)},
+			score:      0, used: 2, ess: 0,
+		},
+		{
+			name:       "engagement",
+			aggregator: Aggregator{Strategy: StrategyEngagement},
+			posts:      []models.SocialPost{post(1, 1, 0, 0), post(-1, 1, doubled, 0)},
+			score:      -1.0 / 3, used: 2, ess: 9.0 / 5,
+		},
+		{
+			name:       "negative engagement counts as none",
+			aggregator: Aggregator{Strategy: StrategyEngagement},
+			posts:      []models.SocialPost{post(1, 1, -5, 0), post(-1, 1, 0, 0)},
+			score:      0, used: 2, ess: 2,
+		},
+		{
+			name:       "reach",
+			aggregator: Aggregator{Strategy: StrategyReach},
+			posts:      []models.SocialPost{post(1, 1, 0, doubled), post(-1, 1, 0, 0)},
+			score:      1.0 / 3, used: 2, ess: 9.0 / 5,
+		},
+		{
+			name:       "trimmed drops each end",
+			aggregator: Aggregator{Strategy: StrategyTrimmed, TrimFraction: 0.2},
+			posts:      []models.SocialPost{post(1, 1, 0, 0), post(0.2, 1, 0, 0), post(-1, 1, 0, 0), post(0.3, 1, 0, 0), post(0.1, 1, 0, 0)},
+			score:      0.2, used: 3, ess: 3,
+		},
+		{
+			name:       "trimmed rounds the cut down",
+			aggregator: Aggregator{Strategy: StrategyTrimmed, TrimFraction: 0.1},
+			posts:      []models.SocialPost{post(1, 1, 0, 0), post(0.2, 1, 0, 0), post(-1, 1, 0, 0), post(0.3, 1, 0, 0), post(0.1, 1, 0, 0)},
+			score:      0.12, used: 5, ess: 5,
+		},
+		{
+			name:       "min confidence filters first",
+			aggregator: Aggregator{Strategy: StrategyMean, MinConfidence: 0.5},
+			posts:      []models.SocialPost{post(1, 0.9, 0, 0), post(-1, 0.1, 0, 0), post(0.5, 0.5, 0, 0)},
+			score:      0.75, used: 2, ess: 2,
+		},
+		{
+			name:       "nothing passes the filter",
+			aggregator: Aggregator{Strategy: StrategyMean, MinConfidence: 0.95},
+			posts:      []models.SocialPost{post(1, 0.9, 0, 0)},
+			score:      0, used: 0, ess: 0,
+		},
+		{
+			name:       "no posts",
+			aggregator: Aggregator{Strategy: StrategyConfidence},
+			score:      0, used: 0, ess: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.aggregator.Aggregate(tt.posts)
+			if math.Abs(result.Score-tt.score) > 1e-9 {
+				t.Errorf("Score = %v, want %v", result.Score, tt.score)
+			}
+			if result.Used != tt.used {
+				t.Errorf("Used = %d, want %d", result.Used, tt.used)
+			}
+			if math.Abs(result.EffectiveSampleSize-tt.ess) > 1e-9 {
+				t.Errorf("EffectiveSampleSize = %v, want %v", result.EffectiveSampleSize, tt.ess)
+			}
+		})
+	}
+}
+
+func TestAggregatorValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		aggregator Aggregator
+		wantTrim   float64
+		wantErr    bool
+	}{
+		{"default", DefaultAggregator(), 0, false},
+		{"untrimmed strategy drops the trim", Aggregator{Strategy: StrategyMean, TrimFraction: 0.3}, 0, false},
+		{"unset trim takes the default", Aggregator{Strategy: StrategyTrimmed}, defaultTrimFraction, false},
+		{"trim kept", Aggregator{Strategy: StrategyTrimmed, TrimFraction: 0.25}, 0.25, false},
+		{"trim of half", Aggregator{Strategy: StrategyTrimmed, TrimFraction: 0.5}, 0, true},
+		{"negative trim", Aggregator{Strategy: StrategyTrimmed, TrimFraction: -0.1}, 0, true},
+		{"unknown strategy", Aggregator{Strategy: "median"}, 0, true},
+		{"full min confidence", Aggregator{Strategy: StrategyReach, MinConfidence: 1}, 0, false},
+		{"negative min confidence", Aggregator{Strategy: StrategyMean, MinConfidence: -0.1}, 0, true},
+		{"min confidence above 1", Aggregator{Strategy: StrategyEngagement, MinConfidence: 1.1}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregator := tt.aggregator
+			err := aggregator.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && aggregator.TrimFraction != tt.wantTrim {
+				t.Errorf("TrimFraction = %v, want %v", aggregator.TrimFraction, tt.wantTrim)
+			}
+		})
+	}
+}
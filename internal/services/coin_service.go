@@ -1,17 +1,33 @@
 package services
 
 import (
+	"context"
+	"crypto-sentiment/internal/cache"
+	"crypto-sentiment/internal/catalog"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
+// DefaultCoinGeckoURL is CoinGecko's public API host
+const DefaultCoinGeckoURL = "https://api.coingecko.com"
+
+// How long prices are fresh, and how long after that they are still served
+// while being refreshed
+const (
+	priceTTL      = 5 * time.Minute
+	priceStaleTTL = 10 * time.Minute
+)
+
 type CoinService struct {
+	baseURL    string
 	httpClient *http.Client
-	cache      map[string]*CoinData
-	cacheTime  map[string]time.Time
+	coins      *catalog.Catalog
+	cache      *cache.Cache[string, *CoinData]
 }
 
 type CoinData struct {
@@ -23,32 +39,67 @@ type CoinData struct {
 	LastUpdated    time.Time `json:"last_updated"`
 }
 
-func NewCoinService() *CoinService {
+// NewCoinService creates a CoinGecko client. coins maps tickers to
+// CoinGecko ids; without it the lowercased symbol is used as the id. An
+// empty base URL defaults to DefaultCoinGeckoURL and transport may be nil
+// for http.DefaultTransport.
+func NewCoinService(base string, coins *catalog.Catalog, transport http.RoundTripper) *CoinService {
 	return &CoinService{
-		httpClient: &http.Client{Timeout: 10 * time.Second},
-		cache:      make(map[string]*CoinData),
-		cacheTime:  make(map[string]time.Time),
+		baseURL:    baseURL(base, DefaultCoinGeckoURL),
+		httpClient: &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		coins:      coins,
+		cache: cache.New[string, *CoinData](cache.Config{
+			TTL:      priceTTL,
+			StaleTTL: priceStaleTTL,
+		}),
 	}
 }
 
-func (cs *CoinService) GetCoinData(symbol string) (*CoinData, error) {
-	// Check cache (valid for 5 minutes)
-	if data, ok := cs.cache[symbol]; ok {
-		if time.Since(cs.cacheTime[symbol]) < 5*time.Minute {
-			return data, nil
-		}
+// GetCoinData returns the market data for symbol. Prices are cached for
+// priceTTL and served for another priceStaleTTL while they are refreshed
+// in the background; otherwise they are requested within ctx.
+func (cs *CoinService) GetCoinData(ctx context.Context, symbol string) (*CoinData, error) {
+	coin, _, err := cs.cache.GetOrLoad(ctx, strings.ToUpper(symbol), func(ctx context.Context) (*CoinData, error) {
+		return cs.fetch(ctx, symbol)
+	})
+	return coin, err
+}
+
+// Catalog returns the coins symbols are resolved against
+func (cs *CoinService) Catalog() *catalog.Catalog {
+	return cs.coins
+}
+
+// CacheStats reports the price cache's hits, misses and evictions
+func (cs *CoinService) CacheStats() cache.Stats {
+	return cs.cache.Stats()
+}
+
+// fetch requests the market data for symbol from CoinGecko
+func (cs *CoinService) fetch(ctx context.Context, symbol string) (*CoinData, error) {
+	id, name, err := cs.resolve(symbol)
+	if err != nil {
+		return nil, err
 	}
 
 	// CoinGecko API URL
-	url := fmt.Sprintf("https://api.coingecko.com/api/v3/simple/price?ids=%s&vs_currencies=usd&include_24hr_change=true&include_market_cap=true",
-		strings.ToLower(symbol))
+	url := fmt.Sprintf("%s/api/v3/simple/price?ids=%s&vs_currencies=usd&include_24hr_change=true&include_market_cap=true",
+		cs.baseURL, id)
 
-	resp, err := cs.httpClient.Get(url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cs.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("coingecko API error: status %d", resp.StatusCode)
+	}
+
 	var result map[string]struct {
 		Usd          float64 `json:"usd"`
 		Usd24hChange float64 `json:"usd_24h_change"`
@@ -61,20 +112,33 @@ func (cs *CoinService) GetCoinData(symbol string) (*CoinData, error) {
 
 	// Process the first result
 	for _, data := range result {
-		coinData := &CoinData{
+		return &CoinData{
 			Symbol:         strings.ToUpper(symbol),
+			Name:           name,
 			CurrentPrice:   data.Usd,
 			PriceChange24h: data.Usd24hChange,
 			MarketCap:      data.UsdMarketCap,
 			LastUpdated:    time.Now(),
-		}
+		}, nil
+	}
 
-		// Update cache
-		cs.cache[symbol] = coinData
-		cs.cacheTime[symbol] = time.Now()
+	return nil, fmt.Errorf("no data found for symbol: %s", symbol)
+}
 
-		return coinData, nil
+// resolve returns the CoinGecko id and display name for symbol. Symbols
+// missing from the catalog are passed through as ids; ambiguous ones fail.
+func (cs *CoinService) resolve(symbol string) (string, string, error) {
+	if cs.coins == nil {
+		return strings.ToLower(symbol), "", nil
 	}
 
-	return nil, fmt.Errorf("no data found for symbol: %s", symbol)
+	coin, err := cs.coins.Resolve(symbol)
+	if err != nil {
+		var notFound *catalog.NotFoundError
+		if errors.As(err, &notFound) {
+			return url.QueryEscape(strings.ToLower(symbol)), "", nil
+		}
+		return "", "", err
+	}
+	return coin.ID, coin.Name, nil
 }
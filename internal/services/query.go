@@ -0,0 +1,28 @@
+package services
+
+import (
+	"crypto-sentiment/internal/catalog"
+	"strings"
+)
+
+// queryTerms returns the catalog search terms for symbol, or the bare
+// symbol when no catalog is configured
+func queryTerms(coins *catalog.Catalog, symbol string) []string {
+	if coins == nil {
+		return []string{strings.ToUpper(symbol)}
+	}
+	return coins.QueryTerms(symbol)
+}
+
+// orQuery joins terms with OR, quoting multi-word terms so that they are
+// matched as phrases, e.g. `SHIB OR "Shiba Inu" OR $SHIB`
+func orQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		if strings.ContainsAny(term, " \t") {
+			term = `"` + term + `"`
+		}
+		quoted[i] = term
+	}
+	return strings.Join(quoted, " OR ")
+}
@@ -1,27 +1,107 @@
 package services
 
 import (
+	"context"
+	"crypto-sentiment/internal/catalog"
+	"crypto-sentiment/internal/models"
+	"crypto-sentiment/internal/oauth"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
-	"os"
+	"sort"
+	"strconv"
 	"time"
 )
 
+// Reddit endpoints. Tokens are issued by the public site and the API is
+// served from a separate host.
+const (
+	DefaultRedditAuthURL = "https://www.reddit.com"
+	DefaultRedditAPIURL  = "https://oauth.reddit.com"
+	redditUserAgent      = "CryptoSentimentBot/1.0"
+)
+
+// Defaults for the RedditConfig limits
+const (
+	defaultRedditWindow         = "day"
+	defaultRedditMaxPosts       = 300
+	defaultRedditMaxPages       = 5
+	defaultRedditCommentThreads = 5
+	defaultRedditMaxComments    = 100
+	// redditPageSize is the largest page Reddit serves
+	redditPageSize = 100
+)
+
+// DefaultSubreddits are searched for every symbol
+var DefaultSubreddits = []string{"CryptoCurrency"}
+
+// redditWindows are the accepted values of RedditConfig.TimeWindow
+var redditWindows = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+// RedditConfig holds the credentials, endpoints and limits of a
+// RedditService. Empty base URLs default to Reddit's own hosts and zero
+// limits to their defaults.
+type RedditConfig struct {
+	ClientID     string
+	ClientSecret string
+	AuthBaseURL  string
+	APIBaseURL   string
+	// Subreddits are searched for every symbol. The coin's own subreddits
+	// from the catalog are read in full in addition.
+	Subreddits []string
+	// TimeWindow is "hour", "day" or "week"; older posts are ignored
+	TimeWindow string
+	// MaxPosts caps the posts collected per symbol, shared evenly between
+	// the subreddits
+	MaxPosts int
+	// MaxPages caps the pages requested per subreddit
+	MaxPages int
+	// CommentThreads is how many of the most discussed posts have their
+	// comments read. A negative value disables comments.
+	CommentThreads int
+	// MaxComments caps the comments read from each thread
+	MaxComments int
+}
+
+// Validate checks the time window and limits
+func (c RedditConfig) Validate() error {
+	if _, ok := redditWindows[c.TimeWindow]; c.TimeWindow != "" && !ok {
+		return fmt.Errorf("unknown Reddit time window %q, use hour, day or week", c.TimeWindow)
+	}
+	if c.MaxPosts < 0 || c.MaxPages < 0 || c.MaxComments < 0 {
+		return fmt.Errorf("reddit limits must not be negative")
+	}
+	return nil
+}
+
 type RedditService struct {
-	clientID     string
-	clientSecret string
-	accessToken  string
-	httpClient   *http.Client
+	apiURL string
+	config RedditConfig
+	coins  *catalog.Catalog
+	// httpClient authorizes every request with a token from tokens
+	httpClient *http.Client
+	tokens     *oauth.TokenSource
 }
 
 type RedditPost struct {
-	Title     string    `json:"title"`
-	SelfText  string    `json:"selftext"`
-	Score     int       `json:"score"`
-	CreatedAt time.Time `json:"created_utc"`
-	Subreddit string    `json:"subreddit"`
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	SelfText    string  `json:"selftext"`
+	Score       int     `json:"score"`
+	NumComments int     `json:"num_comments"`
+	CreatedUTC  float64 `json:"created_utc"`
+	Subreddit   string  `json:"subreddit"`
+}
+
+// CreatedAt converts Reddit's fractional epoch seconds into a time.Time
+func (p RedditPost) CreatedAt() time.Time {
+	return time.Unix(int64(p.CreatedUTC), 0).UTC()
 }
 
 type RedditResponse struct {
@@ -29,30 +109,245 @@ type RedditResponse struct {
 		Children []struct {
 			Data RedditPost `json:"data"`
 		} `json:"children"`
+		// After is the cursor of the next page, empty on the last one
+		After string `json:"after"`
 	} `json:"data"`
 }
 
-func NewRedditService() *RedditService {
+// RedditComment is a single comment from a post's discussion thread
+type RedditComment struct {
+	ID         string  `json:"id"`
+	Body       string  `json:"body"`
+	Score      int     `json:"score"`
+	CreatedUTC float64 `json:"created_utc"`
+}
+
+// CreatedAt converts Reddit's fractional epoch seconds into a time.Time
+func (c RedditComment) CreatedAt() time.Time {
+	return time.Unix(int64(c.CreatedUTC), 0).UTC()
+}
+
+// redditCommentListing is one level of a comment tree. Replies holds a
+// nested listing, or an empty string for comments without replies.
+type redditCommentListing struct {
+	Data struct {
+		Children []struct {
+			Kind string `json:"kind"`
+			Data struct {
+				RedditComment
+				Replies json.RawMessage `json:"replies"`
+			} `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+// NewRedditService creates a Reddit client. coins supplies the search
+// terms and subreddits for each symbol and may be nil to search for the
+// bare ticker. transport carries every request, including token requests,
+// and may be nil for http.DefaultTransport.
+func NewRedditService(config RedditConfig, coins *catalog.Catalog, transport http.RoundTripper) *RedditService {
+	authURL := baseURL(config.AuthBaseURL, DefaultRedditAuthURL)
+	tokens := oauth.NewTokenSource(oauth.Config{
+		TokenURL:     authURL + "/api/v1/access_token",
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		UserAgent:    redditUserAgent,
+	}, &http.Client{Timeout: 10 * time.Second, Transport: transport})
+
+	if len(config.Subreddits) == 0 {
+		config.Subreddits = DefaultSubreddits
+	}
+	if config.TimeWindow == "" {
+		config.TimeWindow = defaultRedditWindow
+	}
+	if config.MaxPosts == 0 {
+		config.MaxPosts = defaultRedditMaxPosts
+	}
+	if config.MaxPages == 0 {
+		config.MaxPages = defaultRedditMaxPages
+	}
+	if config.CommentThreads == 0 {
+		config.CommentThreads = defaultRedditCommentThreads
+	}
+	if config.MaxComments == 0 {
+		config.MaxComments = defaultRedditMaxComments
+	}
+
 	return &RedditService{
-		clientID:     os.Getenv("REDDIT_CLIENT_ID"),
-		clientSecret: os.Getenv("REDDIT_CLIENT_SECRET"),
-		httpClient:   &http.Client{},
+		apiURL: baseURL(config.APIBaseURL, DefaultRedditAPIURL),
+		config: config,
+		coins:  coins,
+		httpClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &oauth.Transport{Source: tokens, Base: transport},
+		},
+		tokens: tokens,
+	}
+}
+
+// Authenticate obtains an access token, or confirms the cached one is
+// still valid
+func (rs *RedditService) Authenticate(ctx context.Context) error {
+	_, err := rs.tokens.Token(ctx)
+	return err
+}
+
+// FetchPosts collects the posts about symbol from within the time window,
+// newest first, following the pagination cursor until the window, the
+// page limit or the subreddit's share of MaxPosts is exhausted. The coin's
+// own subreddits are read in full; the general ones are searched for the
+// coin's terms. Posts found in several places are returned once. A
+// subreddit that can't be read is skipped and reported in a *PartialError
+// unless all of them fail.
+func (rs *RedditService) FetchPosts(ctx context.Context, symbol string) ([]RedditPost, error) {
+	query := orQuery(queryTerms(rs.coins, symbol))
+	cutoff := time.Now().Add(-redditWindows[rs.config.TimeWindow])
+
+	type listing struct {
+		subreddit string
+		search    bool
+	}
+	var listings []listing
+	if rs.coins != nil {
+		for _, subreddit := range rs.coins.Subreddits(symbol) {
+			listings = append(listings, listing{subreddit: subreddit})
+		}
+	}
+	for _, subreddit := range rs.config.Subreddits {
+		listings = append(listings, listing{subreddit: subreddit, search: true})
 	}
+	share := (rs.config.MaxPosts + len(listings) - 1) / len(listings)
+
+	var (
+		posts    []RedditPost
+		seen     = make(map[string]bool)
+		lastErr  error
+		failures []string
+	)
+	for _, l := range listings {
+		if ctx.Err() != nil {
+			// Out of time; the remaining subreddits would fail the same way
+			lastErr = ctx.Err()
+			failures = append(failures, fmt.Sprintf("r/%s: %v", l.subreddit, ctx.Err()))
+			continue
+		}
+
+		params := url.Values{}
+		params.Set("limit", strconv.Itoa(redditPageSize))
+		path := fmt.Sprintf("/r/%s/new.json", url.PathEscape(l.subreddit))
+		if l.search {
+			path = fmt.Sprintf("/r/%s/search.json", url.PathEscape(l.subreddit))
+			params.Set("q", query)
+			params.Set("sort", "new")
+			params.Set("t", rs.config.TimeWindow)
+			params.Set("restrict_sr", "1")
+		}
+
+		var (
+			added int
+			err   error
+		)
+		for page := 0; page < rs.config.MaxPages && added < share; page++ {
+			var response RedditResponse
+			if err = rs.get(ctx, path, params, &response); err != nil {
+				break
+			}
+
+			expired := false
+			for _, child := range response.Data.Children {
+				post := child.Data
+				if post.CreatedAt().Before(cutoff) {
+					// Listings are sorted by date, so the rest is older
+					expired = true
+					break
+				}
+				if seen[post.ID] || added >= share {
+					continue
+				}
+				seen[post.ID] = true
+				posts = append(posts, post)
+				added++
+			}
+
+			if expired || response.Data.After == "" {
+				break
+			}
+			params.Set("after", response.Data.After)
+		}
+
+		if err != nil {
+			log.Printf("Error reading r/%s for %s: %v", l.subreddit, symbol, err)
+			lastErr = err
+			failures = append(failures, fmt.Sprintf("r/%s: %v", l.subreddit, err))
+		}
+	}
+
+	if len(failures) == len(listings) {
+		return nil, lastErr
+	}
+	return posts, partial(failures)
 }
 
-func (rs *RedditService) authenticate() error {
-	authURL := "https://www.reddit.com/api/v1/access_token"
+// FetchComments returns up to MaxComments comments from the thread of the
+// post with the given id, flattened in the order Reddit ranks them.
+// Deleted and removed comments are left out.
+func (rs *RedditService) FetchComments(ctx context.Context, postID string) ([]RedditComment, error) {
+	params := url.Values{}
+	params.Set("limit", strconv.Itoa(rs.config.MaxComments))
+	params.Set("sort", "top")
+
+	// The response holds the post's own listing followed by the comments
+	var response []json.RawMessage
+	if err := rs.get(ctx, fmt.Sprintf("/comments/%s.json", url.PathEscape(postID)), params, &response); err != nil {
+		return nil, err
+	}
+	if len(response) < 2 {
+		return nil, fmt.Errorf("unexpected comments response for post %s", postID)
+	}
 
-	data := url.Values{}
-	data.Set("grant_type", "client_credentials")
+	var comments []RedditComment
+	var walk func(raw json.RawMessage) error
+	walk = func(raw json.RawMessage) error {
+		// Comments without replies carry an empty string instead
+		if len(raw) == 0 || raw[0] != '{' {
+			return nil
+		}
+
+		var level redditCommentListing
+		if err := json.Unmarshal(raw, &level); err != nil {
+			return err
+		}
+		for _, child := range level.Data.Children {
+			if len(comments) >= rs.config.MaxComments {
+				return nil
+			}
+			// "more" stubs stand for comments that weren't loaded
+			if child.Kind != "t1" {
+				continue
+			}
+			if body := child.Data.Body; body != "" && body != "[deleted]" && body != "[removed]" {
+				comments = append(comments, child.Data.RedditComment)
+			}
+			if err := walk(child.Data.Replies); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 
-	req, err := http.NewRequest("POST", authURL, nil)
+	if err := walk(response[1]); err != nil {
+		return nil, fmt.Errorf("error decoding comments of post %s: %v", postID, err)
+	}
+	return comments, nil
+}
+
+// get requests an API path and decodes the JSON response into v
+func (rs *RedditService) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", rs.apiURL+path+"?"+params.Encode(), nil)
 	if err != nil {
 		return err
 	}
-
-	req.SetBasicAuth(rs.clientID, rs.clientSecret)
-	req.Header.Add("User-Agent", "CryptoSentimentBot/1.0")
+	req.Header.Add("User-Agent", redditUserAgent)
 
 	resp, err := rs.httpClient.Do(req)
 	if err != nil {
@@ -60,55 +355,83 @@ func (rs *RedditService) authenticate() error {
 	}
 	defer resp.Body.Close()
 
-	var tokenResp struct {
-		AccessToken string `json:"access_token"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return err
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("reddit API error: status %d", resp.StatusCode)
 	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
 
-	rs.accessToken = tokenResp.AccessToken
-	return nil
+// Name implements SocialSource
+func (rs *RedditService) Name() string {
+	return "reddit"
 }
 
-func (rs *RedditService) FetchPosts(symbol string) ([]RedditPost, error) {
-	if rs.accessToken == "" {
-		if err := rs.authenticate(); err != nil {
-			return nil, err
-		}
+// Fetch implements SocialSource on top of FetchPosts. The comments of the
+// CommentThreads most discussed posts are included as posts of their own,
+// with ids prefixed "t1_". Subreddits and threads that can't be read are
+// skipped and reported in a *PartialError.
+func (rs *RedditService) Fetch(ctx context.Context, symbol string) ([]models.SocialPost, error) {
+	redditPosts, err := rs.FetchPosts(ctx, symbol)
+	var failures []string
+	if partialErr, ok := err.(*PartialError); ok {
+		failures = partialErr.Failures
+	} else if err != nil {
+		return nil, err
 	}
 
-	subreddits := []string{"cryptocurrency", fmt.Sprintf("r/%s", symbol)}
-	var allPosts []RedditPost
-
-	for _, subreddit := range subreddits {
-		url := fmt.Sprintf("https://oauth.reddit.com/r/%s/search.json?q=%s&sort=new&limit=100",
-			subreddit, symbol)
+	posts := make([]models.SocialPost, 0, len(redditPosts))
+	for _, post := range redditPosts {
+		posts = append(posts, models.SocialPost{
+			ID:         post.ID,
+			Platform:   rs.Name(),
+			Content:    post.Title + " " + post.SelfText,
+			Engagement: float64(post.Score),
+			CreatedAt:  post.CreatedAt(),
+		})
+	}
 
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, err
+	for _, post := range rs.discussed(redditPosts) {
+		if ctx.Err() != nil {
+			failures = append(failures, fmt.Sprintf("comments: %v", ctx.Err()))
+			break
 		}
-
-		req.Header.Add("Authorization", "Bearer "+rs.accessToken)
-		req.Header.Add("User-Agent", "CryptoSentimentBot/1.0")
-
-		resp, err := rs.httpClient.Do(req)
+		comments, err := rs.FetchComments(ctx, post.ID)
 		if err != nil {
-			return nil, err
+			log.Printf("Error reading comments of %s for %s: %v", post.ID, symbol, err)
+			failures = append(failures, fmt.Sprintf("comments of %s: %v", post.ID, err))
+			continue
 		}
-		defer resp.Body.Close()
-
-		var redditResp RedditResponse
-		if err := json.NewDecoder(resp.Body).Decode(&redditResp); err != nil {
-			return nil, err
+		for _, comment := range comments {
+			posts = append(posts, models.SocialPost{
+				ID:         "t1_" + comment.ID,
+				Platform:   rs.Name(),
+				Content:    comment.Body,
+				Engagement: float64(comment.Score),
+				CreatedAt:  comment.CreatedAt(),
+			})
 		}
+	}
+	return posts, partial(failures)
+}
 
-		for _, child := range redditResp.Data.Children {
-			allPosts = append(allPosts, child.Data)
+// discussed returns the CommentThreads posts with the most comments
+func (rs *RedditService) discussed(posts []RedditPost) []RedditPost {
+	if rs.config.CommentThreads < 0 {
+		return nil
+	}
+
+	var withComments []RedditPost
+	for _, post := range posts {
+		if post.NumComments > 0 {
+			withComments = append(withComments, post)
 		}
 	}
+	sort.SliceStable(withComments, func(i, j int) bool {
+		return withComments[i].NumComments > withComments[j].NumComments
+	})
 
-	return allPosts, nil
+	if len(withComments) > rs.config.CommentThreads {
+		withComments = withComments[:rs.config.CommentThreads]
+	}
+	return withComments
 }
@@ -7,11 +7,58 @@ import (
 	"time"
 )
 
+const (
+	// negationWindow is how many tokens after a negator are flipped
+	negationWindow = 3
+	// negationScalar flips and slightly weakens a negated term, so that
+	// "not bullish" reads as mildly bearish rather than fully bearish
+	negationScalar = -0.75
+	// modifierWindow is how many tokens a booster or dampener reaches
+	modifierWindow = 2
+)
+
+// negators start a negation scope over the following tokens
+var negators = map[string]bool{
+	"not": true, "no": true, "never": true, "neither": true, "nor": true,
+	"without": true, "hardly": true, "cannot": true,
+	"don't": true, "dont": true, "doesn't": true, "doesnt": true,
+	"didn't": true, "didnt": true, "isn't": true, "isnt": true,
+	"wasn't": true, "wasnt": true, "aren't": true, "arent": true,
+	"won't": true, "wont": true, "can't": true, "cant": true,
+	"ain't": true, "aint": true, "shouldn't": true, "shouldnt": true,
+	"wouldn't": true, "wouldnt": true,
+}
+
+// modifiers scale the next sentiment term: boosters above 1, dampeners below
+var modifiers = map[string]float64{
+	"extremely":  1.6,
+	"incredibly": 1.6,
+	"insanely":   1.6,
+	"super":      1.5,
+	"hugely":     1.5,
+	"massively":  1.5,
+	"mega":       1.5,
+	"very":       1.4,
+	"absolutely": 1.4,
+	"really":     1.3,
+	"so":         1.3,
+	"totally":    1.3,
+	"slightly":   0.5,
+	"marginally": 0.5,
+	"barely":     0.4,
+	"somewhat":   0.6,
+	"kinda":      0.6,
+	"mildly":     0.6,
+}
+
 type SentimentAnalyzer struct {
-	// Cryptocurrency-specific dictionaries
+	// Cryptocurrency-specific dictionaries. Keys are single words, emoji
+	// or multi-word phrases separated by single spaces.
 	positiveWords map[string]float64
 	negativeWords map[string]float64
-	mutex         sync.RWMutex
+	// maxPhraseLen is the longest dictionary entry in tokens
+	maxPhraseLen int
+	mutex        sync.RWMutex
 }
 
 type SentimentResult struct {
@@ -22,8 +69,9 @@ type SentimentResult struct {
 }
 
 func NewSentimentAnalyzer() *SentimentAnalyzer {
-	sa := &SentimentAnalyzer{
-		positiveWords: map[string]float64{
+	sa := &SentimentAnalyzer{}
+	sa.UpdateDictionaries(
+		map[string]float64{
 			"bullish":      1.5,
 			"moon":         1.2,
 			"buy":          1.0,
@@ -39,8 +87,24 @@ func NewSentimentAnalyzer() *SentimentAnalyzer {
 			"upgrade":      1.0,
 			"beat":         0.9,
 			"growth":       0.9,
+			// Phrases
+			"to the moon":   1.5,
+			"all time high": 1.2,
+			"bull run":      1.3,
+			"buy the dip":   1.0,
+			"diamond hands": 1.0,
+			// Emoji
+			"🚀": 1.2,
+			"📈": 1.0,
+			"🌕": 1.0,
+			"🐂": 1.0,
+			"💎": 0.8,
+			"🙌": 0.6,
+			"🔥": 0.6,
+			"💰": 0.6,
+			"🟢": 0.5,
 		},
-		negativeWords: map[string]float64{
+		map[string]float64{
 			"bearish":    -1.5,
 			"dump":       -1.2,
 			"sell":       -1.0,
@@ -55,33 +119,91 @@ func NewSentimentAnalyzer() *SentimentAnalyzer {
 			"downgrade":  -1.0,
 			"miss":       -0.9,
 			"decline":    -0.9,
+			// Phrases
+			"rug pull":        -1.5,
+			"rugpull":         -1.5,
+			"pump and dump":   -1.5,
+			"dead cat bounce": -1.0,
+			"bear market":     -1.2,
+			"paper hands":     -0.6,
+			// Emoji
+			"📉": -1.0,
+			"🐻": -1.0,
+			"🩸": -1.0,
+			"💀": -0.8,
+			"🤡": -0.6,
+			"😭": -0.6,
+			"🔴": -0.5,
 		},
-	}
+	)
 	return sa
 }
 
+// AnalyzeText scores text in [-1, 1]. Each dictionary match contributes
+// its weight, scaled by a preceding booster or dampener and flipped when
+// it falls within negationWindow tokens of a negator. Phrases win over the
+// single words they contain. The mean weight is squashed with tanh so that
+// stronger wording ("very bearish") still scores beyond plain "bearish".
 func (sa *SentimentAnalyzer) AnalyzeText(text string) SentimentResult {
 	sa.mutex.RLock()
 	defer sa.mutex.RUnlock()
 
-	text = strings.ToLower(text)
-	words := strings.Fields(text)
+	tokens := tokenize(text)
 
-	var score float64
-	var matchCount int
-	var keywords []string
+	var (
+		score         float64
+		matchCount    int
+		keywords      []string
+		negateUntil   = -1
+		negator       string
+		modifier      = 1.0
+		modifierUntil = -1
+		modifierWords []string
+	)
 
-	// Calculate sentiment score
-	for _, word := range words {
-		if value, ok := sa.positiveWords[word]; ok {
-			score += value
-			matchCount++
-			keywords = append(keywords, word)
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.boundary {
+			negateUntil, modifierUntil = -1, -1
+			continue
 		}
-		if value, ok := sa.negativeWords[word]; ok {
+
+		if value, length, phrase := sa.match(tokens, i); length > 0 {
+			keyword := phrase
+			if i <= modifierUntil {
+				value *= modifier
+				keyword = strings.Join(append(modifierWords, keyword), " ")
+			}
+			if i <= negateUntil {
+				value *= negationScalar
+				keyword = negator + " " + keyword
+			}
+
 			score += value
 			matchCount++
-			keywords = append(keywords, word)
+			keywords = append(keywords, keyword)
+
+			// A modifier is used up by the term it applies to
+			modifierUntil = -1
+			i += length - 1
+			continue
+		}
+
+		if negators[tok.text] {
+			negateUntil = i + negationWindow
+			negator = tok.text
+			continue
+		}
+
+		if value, ok := modifiers[tok.text]; ok {
+			// Consecutive modifiers compound, e.g. "really very bullish"
+			if i > modifierUntil {
+				modifier = 1
+				modifierWords = nil
+			}
+			modifier *= value
+			modifierWords = append(modifierWords, tok.text)
+			modifierUntil = i + modifierWindow
 		}
 	}
 
@@ -90,19 +212,54 @@ func (sa *SentimentAnalyzer) AnalyzeText(text string) SentimentResult {
 
 	// Normalize score to [-1, 1] range
 	if matchCount > 0 {
-		score = score / float64(matchCount)
+		score = math.Tanh(score / float64(matchCount))
 	}
 
 	return SentimentResult{
-		Score:      math.Max(math.Min(score, 1.0), -1.0),
+		Score:      score,
 		Confidence: confidence,
 		Keywords:   keywords,
 		Timestamp:  time.Now(),
 	}
 }
 
-// UpdateDictionaries allows updating sentiment dictionaries dynamically
+// match returns the weight, length in tokens and text of the longest
+// dictionary entry starting at tokens[start]. Must be called with the read
+// lock held.
+func (sa *SentimentAnalyzer) match(tokens []token, start int) (float64, int, string) {
+	for length := sa.maxPhraseLen; length >= 1; length-- {
+		if start+length > len(tokens) {
+			continue
+		}
+
+		words := make([]string, 0, length)
+		for _, tok := range tokens[start : start+length] {
+			if tok.boundary {
+				break
+			}
+			words = append(words, tok.text)
+		}
+		if len(words) != length {
+			continue
+		}
+
+		phrase := strings.Join(words, " ")
+		if value, ok := sa.positiveWords[phrase]; ok {
+			return value, length, phrase
+		}
+		if value, ok := sa.negativeWords[phrase]; ok {
+			return value, length, phrase
+		}
+	}
+	return 0, 0, ""
+}
+
+// UpdateDictionaries allows updating sentiment dictionaries dynamically.
+// Keys are run through the tokenizer so that entries such as "To the
+// Moon!" or "$BTC" match the text they are compared against.
 func (sa *SentimentAnalyzer) UpdateDictionaries(positive, negative map[string]float64) {
+	positive, negative = normalizeDictionary(positive), normalizeDictionary(negative)
+
 	sa.mutex.Lock()
 	defer sa.mutex.Unlock()
 
@@ -112,4 +269,58 @@ func (sa *SentimentAnalyzer) UpdateDictionaries(positive, negative map[string]fl
 	if negative != nil {
 		sa.negativeWords = negative
 	}
+
+	sa.maxPhraseLen = 1
+	for _, dictionary := range []map[string]float64{sa.positiveWords, sa.negativeWords} {
+		for phrase := range dictionary {
+			if length := len(strings.Fields(phrase)); length > sa.maxPhraseLen {
+				sa.maxPhraseLen = length
+			}
+		}
+	}
+}
+
+// Dictionaries returns copies of the active positive and negative
+// dictionaries
+func (sa *SentimentAnalyzer) Dictionaries() (map[string]float64, map[string]float64) {
+	sa.mutex.RLock()
+	defer sa.mutex.RUnlock()
+
+	return copyDictionary(sa.positiveWords), copyDictionary(sa.negativeWords)
+}
+
+func copyDictionary(dictionary map[string]float64) map[string]float64 {
+	copied := make(map[string]float64, len(dictionary))
+	for phrase, value := range dictionary {
+		copied[phrase] = value
+	}
+	return copied
+}
+
+// NormalizeTerm returns term in the form dictionary keys are stored in,
+// or "" if it contains no words or emoji
+func NormalizeTerm(term string) string {
+	var words []string
+	for _, tok := range tokenize(term) {
+		if !tok.boundary {
+			words = append(words, tok.text)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// normalizeDictionary returns a copy of dictionary keyed by the tokenized
+// form of each entry. Entries that contain no tokens are dropped.
+func normalizeDictionary(dictionary map[string]float64) map[string]float64 {
+	if dictionary == nil {
+		return nil
+	}
+
+	normalized := make(map[string]float64, len(dictionary))
+	for phrase, value := range dictionary {
+		if key := NormalizeTerm(phrase); key != "" {
+			normalized[key] = value
+		}
+	}
+	return normalized
 }
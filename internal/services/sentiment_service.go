@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"crypto-sentiment/internal/models"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// SentimentService fans out over every registered SocialSource and scores
+// the posts with the SentimentAnalyzer.
+type SentimentService struct {
+	registry          *SourceRegistry
+	sentimentAnalyzer *SentimentAnalyzer
+	aggregator        Aggregator
+}
+
+// NewSentimentService wires the service onto its sources. aggregator is
+// the default way posts are combined into scores.
+func NewSentimentService(registry *SourceRegistry, sentimentAnalyzer *SentimentAnalyzer, aggregator Aggregator) *SentimentService {
+	return &SentimentService{
+		registry:          registry,
+		sentimentAnalyzer: sentimentAnalyzer,
+		aggregator:        aggregator,
+	}
+}
+
+// Aggregator returns the default aggregation settings
+func (ss *SentimentService) Aggregator() Aggregator {
+	return ss.aggregator
+}
+
+// SourceNames returns the enabled sources in registration order
+func (ss *SentimentService) SourceNames() []string {
+	return ss.registry.Names()
+}
+
+// HasSource reports whether the named source is enabled
+func (ss *SentimentService) HasSource(name string) bool {
+	_, ok := ss.registry.Get(name)
+	return ok
+}
+
+// sourceBudget is the share of a deadline that Compute gives the sources
+const sourceBudget = 0.8
+
+// sourceGrace is how long Compute waits for sources to return their
+// partial results once their time is up
+const sourceGrace = 100 * time.Millisecond
+
+// sourceResult is the outcome of fetching and scoring a single source
+type sourceResult struct {
+	name    string
+	posts   []models.SocialPost
+	err     error
+	latency time.Duration
+}
+
+// status classifies the fetch as ok, degraded or error
+func (r sourceResult) status() models.SourceSentiment {
+	source := models.SourceSentiment{Status: models.SourceOK, LatencyMS: r.latency.Milliseconds()}
+	var partial *PartialError
+	switch {
+	case errors.As(r.err, &partial):
+		source.Status = models.SourceDegraded
+		source.Reason = partial.Error()
+	case r.err != nil:
+		source.Status = models.SourceError
+		source.Reason = r.err.Error()
+	}
+	return source
+}
+
+// Compute fetches and scores the current posts for symbol from every
+// source concurrently and aggregates them with the default aggregator.
+// Sources lists the status of every enabled and disabled source; only the
+// healthy ones count towards the scores. When no source is healthy the
+// result is returned along with an error, so that callers can still report
+// why.
+//
+// If ctx has a deadline, the sources share sourceBudget of the time left
+// and the rest is kept for scoring and storing the result. A source that
+// hasn't returned by then is reported as an error and not waited for.
+func (ss *SentimentService) Compute(ctx context.Context, symbol string) (*models.SentimentData, error) {
+	return ss.ComputeSources(ctx, symbol, nil)
+}
+
+// ComputeSources is Compute limited to the named sources. Names that
+// aren't enabled are ignored; nil means every source.
+func (ss *SentimentService) ComputeSources(ctx context.Context, symbol string, names []string) (*models.SentimentData, error) {
+	symbol = strings.ToUpper(symbol)
+	sources := ss.registry.Sources()
+	if names != nil {
+		sources = selectSources(sources, names)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no sources enabled")
+	}
+
+	var (
+		fetchCtx context.Context
+		cancel   context.CancelFunc
+	)
+	if deadline, ok := ctx.Deadline(); ok {
+		budget := time.Duration(float64(time.Until(deadline)) * sourceBudget)
+		fetchCtx, cancel = context.WithTimeout(ctx, budget)
+	} else {
+		fetchCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	type indexed struct {
+		i      int
+		result sourceResult
+	}
+	start := time.Now()
+	done := make(chan indexed, len(sources))
+	for i, source := range sources {
+		go func(i int, source SocialSource) {
+			posts, err := source.Fetch(fetchCtx, symbol)
+			done <- indexed{i, sourceResult{name: source.Name(), posts: posts, err: err, latency: time.Since(start)}}
+		}(i, source)
+	}
+
+	results := make([]sourceResult, len(sources))
+	received := make([]bool, len(sources))
+	stop := fetchCtx.Done()
+	var giveUp <-chan time.Time
+	for pending := len(sources); pending > 0; {
+		select {
+		case r := <-done:
+			results[r.i] = r.result
+			received[r.i] = true
+			pending--
+		case <-stop:
+			// Give the sources a moment to return what they have
+			stop = nil
+			giveUp = time.After(sourceGrace)
+		case <-giveUp:
+			pending = 0
+		}
+	}
+	for i, source := range sources {
+		if !received[i] {
+			results[i] = sourceResult{
+				name:    source.Name(),
+				err:     fmt.Errorf("no response before the deadline"),
+				latency: time.Since(start),
+			}
+		}
+	}
+
+	data := &models.SentimentData{
+		Symbol:    symbol,
+		Timestamp: time.Now(),
+		Sources:   make(map[string]models.SourceSentiment, len(results)),
+	}
+	if names == nil {
+		for name, reason := range ss.registry.Disabled() {
+			data.Sources[name] = models.SourceSentiment{Status: models.SourceDisabled, Reason: reason}
+		}
+	}
+
+	var (
+		lastErr error
+		healthy int
+	)
+	for _, result := range results {
+		source := result.status()
+		data.Sources[result.name] = source
+		if result.err != nil {
+			log.Printf("%s error for %s: %v", result.name, symbol, result.err)
+		}
+		if !source.Healthy() {
+			lastErr = result.err
+			continue
+		}
+		healthy++
+
+		ss.scorePosts(result.posts)
+		data.AnalyzedPosts = append(data.AnalyzedPosts, result.posts...)
+	}
+
+	Aggregate(data, ss.aggregator)
+	if healthy == 0 {
+		return data, lastErr
+	}
+	return data, nil
+}
+
+// selectSources returns the sources whose names are listed
+func selectSources(sources []SocialSource, names []string) []SocialSource {
+	var selected []SocialSource
+	for _, source := range sources {
+		for _, name := range names {
+			if source.Name() == name {
+				selected = append(selected, source)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// Aggregate recomputes the overall and per-source scores of data from its
+// AnalyzedPosts using aggregator. Only the scores of healthy sources are
+// set; the status of every source is left as it is.
+func Aggregate(data *models.SentimentData, aggregator Aggregator) {
+	bySource := make(map[string][]models.SocialPost)
+	for _, post := range data.AnalyzedPosts {
+		bySource[post.Platform] = append(bySource[post.Platform], post)
+	}
+
+	for name, source := range data.Sources {
+		if !source.Healthy() {
+			continue
+		}
+		result := aggregator.Aggregate(bySource[name])
+		source.Score = result.Score
+		source.Posts = len(bySource[name])
+		source.Used = result.Used
+		source.EffectiveSampleSize = result.EffectiveSampleSize
+		data.Sources[name] = source
+	}
+
+	overall := aggregator.Aggregate(data.AnalyzedPosts)
+	data.Score = overall.Score
+	data.Posts = len(data.AnalyzedPosts)
+	data.Aggregation = &models.AggregationInfo{
+		Strategy:            aggregator.Strategy,
+		MinConfidence:       aggregator.MinConfidence,
+		TrimFraction:        aggregator.TrimFraction,
+		Used:                overall.Used,
+		EffectiveSampleSize: overall.EffectiveSampleSize,
+	}
+
+	// Keep the fixed reddit/twitter columns populated for existing clients
+	data.Reddit, data.RedditPosts = 0, 0
+	data.Twitter, data.Tweets = nil, 0
+	if reddit, ok := data.Sources["reddit"]; ok && reddit.Healthy() {
+		data.Reddit = reddit.Score
+		data.RedditPosts = reddit.Posts
+	}
+	if twitter, ok := data.Sources["twitter"]; ok && twitter.Healthy() {
+		score := twitter.Score
+		data.Twitter = &score
+		data.Tweets = twitter.Posts
+	}
+}
+
+// scorePosts sets the sentiment, confidence and matched keywords of every
+// post
+func (ss *SentimentService) scorePosts(posts []models.SocialPost) {
+	for i := range posts {
+		result := ss.sentimentAnalyzer.AnalyzeText(posts[i].Content)
+		posts[i].Sentiment = result.Score
+		posts[i].Confidence = result.Confidence
+		posts[i].Keywords = result.Keywords
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"lowercases words", "Very BULLISH", []string{"very", "bullish"}},
+		{"punctuation ends a clause", "bullish! bearish", []string{"bullish", "|", "bearish"}},
+		{"repeated punctuation is one boundary", "bullish!!! ok", []string{"bullish", "|", "ok"}},
+		{"cashtag marker is dropped", "$BTC", []string{"btc"}},
+		{"emoji split from cashtag", "$BTC🚀", []string{"btc", "🚀"}},
+		{"each emoji is a token", "📉📉", []string{"📉", "📉"}},
+		{"variation selector is dropped", "🔥️", []string{"🔥"}},
+		{"curly apostrophe is normalized", "don’t", []string{"don't"}},
+		{"quotes are trimmed", "'moon'", []string{"moon"}},
+		{"hashtag marker is dropped", "#crypto", []string{"crypto"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, tok := range tokenize(tt.text) {
+				if tok.boundary {
+					got = append(got, "|")
+				} else {
+					got = append(got, tok.text)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		score    float64
+		keywords []string
+	}{
+		// Negation
+		{"plain term", "bullish", math.Tanh(1.5), []string{"bullish"}},
+		{"negated term", "not bullish", math.Tanh(1.5 * negationScalar), []string{"not bullish"}},
+		{"negation reaches the third token", "not that much bullish", math.Tanh(1.5 * negationScalar), []string{"not bullish"}},
+		{"negation stops after the window", "not that much more bullish", math.Tanh(1.5), []string{"bullish"}},
+		{"negation stops at a clause boundary", "not today. bullish", math.Tanh(1.5), []string{"bullish"}},
+		{"contraction negates", "don't sell", math.Tanh(-1.0 * negationScalar), []string{"don't sell"}},
+
+		// Punctuation and cashtags
+		{"trailing punctuation", "bullish!", math.Tanh(1.5), []string{"bullish"}},
+		{"cashtag with emoji", "$BTC🚀", math.Tanh(1.2), []string{"🚀"}},
+
+		// Boosters and dampeners
+		{"booster", "very bearish", math.Tanh(-1.5 * 1.4), []string{"very bearish"}},
+		{"dampener", "slightly bearish", math.Tanh(-1.5 * 0.5), []string{"slightly bearish"}},
+		{"compounded boosters", "really very bullish", math.Tanh(1.5 * 1.3 * 1.4), []string{"really very bullish"}},
+		{"modifier used up by its term", "very bullish bullish", math.Tanh((1.5*1.4 + 1.5) / 2), []string{"very bullish", "bullish"}},
+		{"negated booster", "not very bullish", math.Tanh(1.5 * 1.4 * negationScalar), []string{"not very bullish"}},
+
+		// Emoji
+		{"single emoji", "📉", math.Tanh(-1.0), []string{"📉"}},
+		{"emoji mean", "🚀📉", math.Tanh((1.2 - 1.0) / 2), []string{"🚀", "📉"}},
+
+		// Phrases
+		{"phrase wins over its words", "to the moon", math.Tanh(1.5), []string{"to the moon"}},
+		{"negative phrase", "total rug pull", math.Tanh(-1.5), []string{"rug pull"}},
+		{"phrase broken by a boundary", "to the. moon", math.Tanh(1.2), []string{"moon"}},
+
+		// No matches
+		{"no sentiment", "the market opened", 0, nil},
+	}
+
+	analyzer := NewSentimentAnalyzer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := analyzer.AnalyzeText(tt.text)
+			if math.Abs(result.Score-tt.score) > 1e-9 {
+				t.Errorf("AnalyzeText(%q).Score = %v, want %v", tt.text, result.Score, tt.score)
+			}
+			if !reflect.DeepEqual(result.Keywords, tt.keywords) {
+				t.Errorf("AnalyzeText(%q).Keywords = %q, want %q", tt.text, result.Keywords, tt.keywords)
+			}
+		})
+	}
+}
+
+func TestAnalyzeTextBoosterOutscoresPlain(t *testing.T) {
+	analyzer := NewSentimentAnalyzer()
+	plain := analyzer.AnalyzeText("bearish").Score
+	boosted := analyzer.AnalyzeText("very bearish").Score
+	dampened := analyzer.AnalyzeText("slightly bearish").Score
+
+	if !(boosted < plain && plain < dampened && dampened < 0) {
+		t.Errorf("want very bearish (%v) < bearish (%v) < slightly bearish (%v) < 0", boosted, plain, dampened)
+	}
+}
+
+func TestAnalyzeTextBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"strong positive", "extremely bullish extremely bullish 🚀🚀🚀 to the moon"},
+		{"strong negative", "incredibly bearish crash rug pull 📉📉 💀"},
+		{"negated strong", "not extremely bullish"},
+		{"mixed", "bullish but bearish, very weak, super strong"},
+	}
+
+	analyzer := NewSentimentAnalyzer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := analyzer.AnalyzeText(tt.text)
+			if result.Score <= -1 || result.Score >= 1 {
+				t.Errorf("AnalyzeText(%q).Score = %v, want within (-1, 1)", tt.text, result.Score)
+			}
+			if result.Confidence < 0 || result.Confidence > 1 {
+				t.Errorf("AnalyzeText(%q).Confidence = %v, want within [0, 1]", tt.text, result.Confidence)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"crypto-sentiment/internal/models"
+	"strings"
+	"sync"
+)
+
+// SocialSource is a platform that posts about a symbol can be collected
+// from. Implementations convert their native results into SocialPost so
+// that every platform is scored the same way.
+type SocialSource interface {
+	// Name identifies the source in responses and storage, e.g. "reddit"
+	Name() string
+	// Fetch returns the posts about symbol, giving up when ctx is done.
+	// When only part of the fetch failed it returns the posts it has along
+	// with a *PartialError.
+	Fetch(ctx context.Context, symbol string) ([]models.SocialPost, error)
+}
+
+// PartialError reports the parts of a fetch that failed while the rest
+// succeeded
+type PartialError struct {
+	Failures []string
+}
+
+func (e *PartialError) Error() string {
+	return strings.Join(e.Failures, "; ")
+}
+
+// partial returns a *PartialError for failures, or nil if there are none
+func partial(failures []string) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	return &PartialError{Failures: failures}
+}
+
+// SourceRegistry holds the enabled sources in registration order, and the
+// reason each known but disabled source is off
+type SourceRegistry struct {
+	sources  []SocialSource
+	disabled map[string]string
+	mutex    sync.RWMutex
+}
+
+func NewSourceRegistry(sources ...SocialSource) *SourceRegistry {
+	registry := &SourceRegistry{disabled: make(map[string]string)}
+	for _, source := range sources {
+		registry.Register(source)
+	}
+	return registry
+}
+
+// Register adds source, replacing any source with the same name
+func (r *SourceRegistry) Register(source SocialSource) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.disabled, source.Name())
+	for i, existing := range r.sources {
+		if existing.Name() == source.Name() {
+			r.sources[i] = source
+			return
+		}
+	}
+	r.sources = append(r.sources, source)
+}
+
+// Sources returns a snapshot of the registered sources
+func (r *SourceRegistry) Sources() []SocialSource {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return append([]SocialSource(nil), r.sources...)
+}
+
+// Get returns the source registered under name
+func (r *SourceRegistry) Get(name string) (SocialSource, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, source := range r.sources {
+		if source.Name() == name {
+			return source, true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the registered source names in registration order
+func (r *SourceRegistry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, len(r.sources))
+	for i, source := range r.sources {
+		names[i] = source.Name()
+	}
+	return names
+}
+
+// Disable records that the named source is off for reason, e.g. missing
+// credentials, so that results can report it. A registered source of that
+// name is removed.
+func (r *SourceRegistry) Disable(name, reason string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, existing := range r.sources {
+		if existing.Name() == name {
+			r.sources = append(r.sources[:i], r.sources[i+1:]...)
+			break
+		}
+	}
+	r.disabled[name] = reason
+}
+
+// Disabled returns the reason of every disabled source keyed by name
+func (r *SourceRegistry) Disabled() map[string]string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	disabled := make(map[string]string, len(r.disabled))
+	for name, reason := range r.disabled {
+		disabled[name] = reason
+	}
+	return disabled
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// token is one unit of analyzed text. Boundary tokens mark the end of a
+// clause (., !, ? and the like) and stop negation and booster scopes.
+type token struct {
+	text     string
+	boundary bool
+}
+
+// tokenize lowercases text and splits it into words and emoji. Cashtag and
+// hashtag markers are dropped ("$BTC" becomes "btc"), curly apostrophes
+// are normalized to straight ones, and every emoji is its own token so
+// that "$BTC🚀" yields "btc" and "🚀".
+func tokenize(text string) []token {
+	var (
+		tokens []token
+		word   strings.Builder
+	)
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, token{text: word.String()})
+			word.Reset()
+		}
+	}
+	boundary := func() {
+		flush()
+		if len(tokens) > 0 && !tokens[len(tokens)-1].boundary {
+			tokens = append(tokens, token{boundary: true})
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		case r == '\'' || r == '\u2019':
+			// Keep apostrophes inside words only
+			if word.Len() > 0 {
+				word.WriteRune('\'')
+			}
+		case strings.ContainsRune(".!?;:,", r):
+			boundary()
+		case r == '\u200d' || r == '\ufe0f' || unicode.Is(unicode.Sk, r) || unicode.Is(unicode.Mn, r):
+			// Joiners, variation selectors and skin tones belong to the
+			// preceding emoji and carry no sentiment of their own
+		case unicode.Is(unicode.So, r):
+			flush()
+			tokens = append(tokens, token{text: string(r)})
+		default:
+			// Whitespace, $, #, quotes, brackets and other separators
+			flush()
+		}
+	}
+	flush()
+
+	// Drop trailing apostrophes left by quotes such as 'moon'
+	for i := range tokens {
+		tokens[i].text = strings.TrimRight(tokens[i].text, "'")
+	}
+
+	return tokens
+}
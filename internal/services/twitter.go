@@ -1,165 +1,361 @@
 package services
 
 import (
-	"encoding/base64"
+	"context"
+	"crypto-sentiment/internal/catalog"
+	"crypto-sentiment/internal/models"
+	"crypto-sentiment/internal/oauth"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
-	"os"
-	"strings"
+	"strconv"
+	"sync"
 	"time"
 )
 
+// Defaults for the TwitterConfig limits
+const (
+	defaultTwitterMaxTweets = 300
+	defaultTwitterWindow    = 24 * time.Hour
+	// maxTwitterWindow is how far back recent search reaches
+	maxTwitterWindow = 7 * 24 * time.Hour
+	// twitterPageSize is the largest page recent search serves
+	twitterPageSize = 100
+)
+
 type Tweet struct {
+	ID        string       `json:"id"`
+	Text      string       `json:"text"`
+	AuthorID  string       `json:"author_id"`
+	CreatedAt time.Time    `json:"created_at"`
+	Metrics   TweetMetrics `json:"public_metrics"`
+	Author    *TwitterUser `json:"author,omitempty"`
+}
+
+// Engagement is the total number of interactions with the tweet
+func (t Tweet) Engagement() int {
+	return t.Metrics.Likes + t.Metrics.Retweets + t.Metrics.Replies + t.Metrics.Quotes
+}
+
+// TweetMetrics are a tweet's public interaction counts
+type TweetMetrics struct {
+	Likes    int `json:"like_count"`
+	Retweets int `json:"retweet_count"`
+	Replies  int `json:"reply_count"`
+	Quotes   int `json:"quote_count"`
+}
+
+// TwitterUser is the author of a tweet, from the response's expansions
+type TwitterUser struct {
 	ID        string    `json:"id"`
-	Text      string    `json:"text"`
+	Username  string    `json:"username"`
 	CreatedAt time.Time `json:"created_at"`
+	Metrics   struct {
+		Followers int `json:"followers_count"`
+		Following int `json:"following_count"`
+		Tweets    int `json:"tweet_count"`
+	} `json:"public_metrics"`
 }
 
 type TwitterResponse struct {
-	Data []struct {
-		ID        string    `json:"id"`
-		Text      string    `json:"text"`
-		CreatedAt time.Time `json:"created_at"`
-	} `json:"data"`
+	Data     []Tweet `json:"data"`
+	Includes struct {
+		Users []TwitterUser `json:"users"`
+	} `json:"includes"`
 	Meta struct {
 		ResultCount  int    `json:"result_count"`
+		NewestID     string `json:"newest_id"`
 		NextToken    string `json:"next_token"`
 		RefreshedURL string `json:"refreshed_url"`
 	} `json:"meta"`
 }
 
+// DefaultTwitterURL serves both the v2 API and app-only bearer tokens
+const DefaultTwitterURL = "https://api.twitter.com"
+
+// TwitterConfig holds the credentials, endpoint and limits of a
+// TwitterService. An empty BaseURL defaults to DefaultTwitterURL and zero
+// limits to their defaults.
+type TwitterConfig struct {
+	APIKey    string
+	APISecret string
+	BaseURL   string
+	// MaxTweets caps the tweets kept per symbol
+	MaxTweets int
+	// Window is how far back tweets are collected, at most seven days
+	Window time.Duration
+	// MinFollowers and MinAccountAge leave out tweets from accounts that
+	// look like bots
+	MinFollowers  int
+	MinAccountAge time.Duration
+}
+
+// Validate checks the window and limits
+func (c TwitterConfig) Validate() error {
+	if c.Window < 0 || c.Window > maxTwitterWindow {
+		return fmt.Errorf("twitter window must be at most %s", maxTwitterWindow)
+	}
+	if c.MaxTweets < 0 || c.MinFollowers < 0 || c.MinAccountAge < 0 {
+		return fmt.Errorf("twitter limits must not be negative")
+	}
+	return nil
+}
+
 type TwitterService struct {
-	apiKey      string
-	apiSecret   string
-	bearerToken string
-	httpClient  *http.Client
+	baseURL string
+	config  TwitterConfig
+	coins   *catalog.Catalog
+	// httpClient authorizes every request with a token from tokens
+	httpClient *http.Client
+	tokens     *oauth.TokenSource
+
+	// timelines holds the tweets collected so far for each symbol
+	timelines map[string]*timeline
+	mutex     sync.Mutex
+}
+
+// timeline is the window of tweets kept for a symbol, newest first, and
+// the id the next search continues from
+type timeline struct {
+	sinceID string
+	tweets  []Tweet
 }
 
-func NewTwitterService() (*TwitterService, error) {
+// NewTwitterService creates a Twitter client and fetches its bearer token
+// within ctx, so that bad credentials are reported up front. coins
+// supplies the search terms for each symbol and may be nil to search for
+// the bare ticker. transport carries every request, including token
+// requests, and may be nil for http.DefaultTransport.
+func NewTwitterService(ctx context.Context, config TwitterConfig, coins *catalog.Catalog, transport http.RoundTripper) (*TwitterService, error) {
+	base := baseURL(config.BaseURL, DefaultTwitterURL)
+	tokens := oauth.NewTokenSource(oauth.Config{
+		TokenURL:     base + "/oauth2/token",
+		ClientID:     config.APIKey,
+		ClientSecret: config.APISecret,
+	}, &http.Client{Timeout: 10 * time.Second, Transport: transport})
+
+	if config.MaxTweets == 0 {
+		config.MaxTweets = defaultTwitterMaxTweets
+	}
+	if config.Window == 0 {
+		config.Window = defaultTwitterWindow
+	}
+
 	ts := &TwitterService{
-		apiKey:     os.Getenv("TWITTER_API_KEY"),
-		apiSecret:  os.Getenv("TWITTER_API_SECRET"),
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		baseURL: base,
+		config:  config,
+		coins:   coins,
+		httpClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &oauth.Transport{Source: tokens, Base: transport},
+		},
+		tokens:    tokens,
+		timelines: make(map[string]*timeline),
 	}
 
-	// Get bearer token during initialization
-	token, err := ts.getBearerToken()
-	if err != nil {
+	if _, err := tokens.Token(ctx); err != nil {
 		return nil, fmt.Errorf("failed to get bearer token: %v", err)
 	}
-
-	ts.bearerToken = token
 	return ts, nil
 }
 
-func (ts *TwitterService) getBearerToken() (string, error) {
-	credentials := base64.StdEncoding.EncodeToString(
-		[]byte(fmt.Sprintf("%s:%s", ts.apiKey, ts.apiSecret)))
+// FetchTweets returns the tweets about symbol from within the window,
+// newest first, with their metrics and authors. Only tweets newer than the
+// previous call are requested; they are merged with the ones collected
+// before, up to MaxTweets. Tweets from bot-like accounts are left out. If
+// a later page fails, the tweets collected so far are returned along with
+// a *PartialError, and the next call searches from the same point again.
+func (ts *TwitterService) FetchTweets(ctx context.Context, symbol string) ([]Tweet, error) {
+	ts.mutex.Lock()
+	var sinceID string
+	if current, ok := ts.timelines[symbol]; ok {
+		sinceID = current.sinceID
+	}
+	ts.mutex.Unlock()
 
-	data := url.Values{}
-	data.Set("grant_type", "client_credentials")
+	// A bare ticker needs "crypto" to stay on topic; catalog terms such as
+	// the coin name and cashtag don't
+	terms := queryTerms(ts.coins, symbol)
+	search := fmt.Sprintf("%s crypto", symbol)
+	if len(terms) > 1 {
+		search = fmt.Sprintf("(%s)", orQuery(terms))
+	}
 
-	req, err := http.NewRequest(
-		"POST",
-		"https://api.twitter.com/oauth2/token",
-		strings.NewReader(data.Encode()),
-	)
-	if err != nil {
-		return "", err
+	params := url.Values{}
+	params.Set("query", search+" -is:retweet lang:en")
+	params.Set("max_results", strconv.Itoa(twitterPageSize))
+	params.Set("tweet.fields", "created_at,public_metrics,author_id")
+	params.Set("expansions", "author_id")
+	params.Set("user.fields", "created_at,public_metrics,username")
+	if sinceID != "" {
+		params.Set("since_id", sinceID)
+	} else {
+		// Recent search rejects a start time right at its seven day limit
+		start := time.Now().Add(-ts.config.Window).Add(time.Minute)
+		params.Set("start_time", start.UTC().Format(time.RFC3339))
 	}
 
-	req.Header.Set("Authorization", "Basic "+credentials)
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+	var (
+		fresh    []Tweet
+		newestID string
+		failures []string
+	)
+	for page := 1; len(fresh) < ts.config.MaxTweets; page++ {
+		response, err := ts.search(ctx, params)
+		if err != nil && page == 1 {
+			return nil, err
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("page %d: %v", page, err))
+			break
+		}
+		if newestID == "" {
+			newestID = response.Meta.NewestID
+		}
+
+		authors := make(map[string]TwitterUser, len(response.Includes.Users))
+		for _, user := range response.Includes.Users {
+			authors[user.ID] = user
+		}
+		for _, tweet := range response.Data {
+			if author, ok := authors[tweet.AuthorID]; ok {
+				tweet.Author = &author
+			}
+			fresh = append(fresh, tweet)
+		}
 
-	resp, err := ts.httpClient.Do(req)
-	if err != nil {
-		return "", err
+		if response.Meta.NextToken == "" {
+			break
+		}
+		params.Set("next_token", response.Meta.NextToken)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		var errorResponse map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&errorResponse)
-		return "", fmt.Errorf("twitter API error: %v", errorResponse)
+	if len(failures) > 0 {
+		// Keep the previous since_id so that the missed pages are searched
+		// again next time. Pages left unread at MaxTweets are older than
+		// the ones kept, so merge would drop them anyway.
+		newestID = ""
 	}
+	return ts.merge(symbol, fresh, newestID), partial(failures)
+}
+
+// merge adds fresh tweets to symbol's timeline, drops those that left the
+// window or exceed MaxTweets, and returns the ones from accounts that
+// don't look like bots
+func (ts *TwitterService) merge(symbol string, fresh []Tweet, newestID string) []Tweet {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
 
-	var result struct {
-		AccessToken string `json:"access_token"`
-		TokenType   string `json:"token_type"`
+	current, ok := ts.timelines[symbol]
+	if !ok {
+		current = &timeline{}
+		ts.timelines[symbol] = current
+	}
+	if newestID != "" {
+		current.sinceID = newestID
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	cutoff := time.Now().Add(-ts.config.Window)
+	seen := make(map[string]bool, len(fresh)+len(current.tweets))
+	var kept []Tweet
+	for _, tweet := range append(fresh, current.tweets...) {
+		if seen[tweet.ID] || tweet.CreatedAt.Before(cutoff) || len(kept) >= ts.config.MaxTweets {
+			continue
+		}
+		seen[tweet.ID] = true
+		kept = append(kept, tweet)
 	}
+	current.tweets = kept
 
-	return result.AccessToken, nil
+	tweets := make([]Tweet, 0, len(kept))
+	for _, tweet := range kept {
+		if !ts.botLike(tweet.Author) {
+			tweets = append(tweets, tweet)
+		}
+	}
+	return tweets
 }
 
-// FetchTweets retrieves tweets for a given cryptocurrency symbol
-func (ts *TwitterService) FetchTweets(symbol string) ([]Tweet, error) {
-	// Create query parameters
-	query := url.QueryEscape(fmt.Sprintf("%s crypto -is:retweet lang:en", symbol))
-	requestURL := fmt.Sprintf(
-		"https://api.twitter.com/2/tweets/search/recent?query=%s&max_results=100&tweet.fields=created_at",
-		query,
-	)
+// botLike reports whether author falls below MinFollowers or
+// MinAccountAge. Tweets whose author wasn't expanded are kept.
+func (ts *TwitterService) botLike(author *TwitterUser) bool {
+	if author == nil {
+		return false
+	}
+	if author.Metrics.Followers < ts.config.MinFollowers {
+		return true
+	}
+	return ts.config.MinAccountAge > 0 && !author.CreatedAt.IsZero() &&
+		time.Since(author.CreatedAt) < ts.config.MinAccountAge
+}
 
-	// Create request
-	req, err := http.NewRequest("GET", requestURL, nil)
+// search requests one page of recent search results
+func (ts *TwitterService) search(ctx context.Context, params url.Values) (*TwitterResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", ts.baseURL+"/2/tweets/search/recent?"+params.Encode(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %v", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.bearerToken))
-
-	// Make request
 	resp, err := ts.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error making request: %v", err)
 	}
 	defer resp.Body.Close()
 
-	// Check response status
 	if resp.StatusCode != http.StatusOK {
 		var errorResponse map[string]interface{}
 		json.NewDecoder(resp.Body).Decode(&errorResponse)
 		return nil, fmt.Errorf("twitter API error: %v", errorResponse)
 	}
 
-	// Parse response
 	var twitterResp TwitterResponse
 	if err := json.NewDecoder(resp.Body).Decode(&twitterResp); err != nil {
 		return nil, fmt.Errorf("error decoding response: %v", err)
 	}
+	return &twitterResp, nil
+}
 
-	// Convert response to Tweet slice
-	tweets := make([]Tweet, len(twitterResp.Data))
-	for i, data := range twitterResp.Data {
-		tweets[i] = Tweet{
-			ID:        data.ID,
-			Text:      data.Text,
-			CreatedAt: data.CreatedAt,
-		}
+// Name implements SocialSource
+func (ts *TwitterService) Name() string {
+	return "twitter"
+}
+
+// Fetch implements SocialSource on top of FetchTweets
+func (ts *TwitterService) Fetch(ctx context.Context, symbol string) ([]models.SocialPost, error) {
+	tweets, err := ts.FetchTweets(ctx, symbol)
+	if _, ok := err.(*PartialError); err != nil && !ok {
+		return nil, err
 	}
 
-	return tweets, nil
+	posts := make([]models.SocialPost, len(tweets))
+	for i, tweet := range tweets {
+		posts[i] = models.SocialPost{
+			ID:         tweet.ID,
+			Platform:   ts.Name(),
+			Content:    tweet.Text,
+			Engagement: float64(tweet.Engagement()),
+			CreatedAt:  tweet.CreatedAt,
+		}
+		if tweet.Author != nil {
+			posts[i].Reach = float64(tweet.Author.Metrics.Followers)
+		}
+	}
+	return posts, err
 }
 
-func (ts *TwitterService) TestConnection() error {
+func (ts *TwitterService) TestConnection(ctx context.Context) error {
 	// Test the connection with a simple search request
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"GET",
-		"https://api.twitter.com/2/tweets/search/recent?query=bitcoin",
+		ts.baseURL+"/2/tweets/search/recent?query=bitcoin",
 		nil,
 	)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.bearerToken))
-
 	resp, err := ts.httpClient.Do(req)
 	if err != nil {
 		return err
@@ -0,0 +1,12 @@
+package services
+
+import "strings"
+
+// baseURL returns configured without a trailing slash, or fallback when
+// it is empty
+func baseURL(configured, fallback string) string {
+	if configured == "" {
+		return fallback
+	}
+	return strings.TrimRight(configured, "/")
+}
@@ -0,0 +1,78 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// minSamples is the fewest pairs a correlation is computed from
+const minSamples = 3
+
+// Pearson returns the Pearson correlation coefficient of x and y. ok is
+// false when the slices differ in length, have fewer than three pairs, or
+// either series is constant.
+func Pearson(x, y []float64) (r float64, ok bool) {
+	if len(x) != len(y) || len(x) < minSamples {
+		return 0, false
+	}
+
+	meanX, meanY := mean(x), mean(y)
+
+	var cov, varX, varY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0, false
+	}
+
+	return cov / math.Sqrt(varX*varY), true
+}
+
+// Spearman returns the Spearman rank correlation of x and y, i.e. the
+// Pearson correlation of their ranks with ties sharing an averaged rank.
+func Spearman(x, y []float64) (rho float64, ok bool) {
+	if len(x) != len(y) {
+		return 0, false
+	}
+	return Pearson(ranks(x), ranks(y))
+}
+
+// ranks returns the 1-based rank of every value, averaging tied ranks
+func ranks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return values[order[a]] < values[order[b]]
+	})
+
+	result := make([]float64, len(values))
+	for start := 0; start < len(order); {
+		end := start + 1
+		for end < len(order) && values[order[end]] == values[order[start]] {
+			end++
+		}
+
+		// Positions start..end-1 are tied; give each the mean rank
+		rank := float64(start+end+1) / 2
+		for _, index := range order[start:end] {
+			result[index] = rank
+		}
+		start = end
+	}
+
+	return result
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,81 @@
+package stats
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+const tolerance = 1e-9
+
+func TestPearson(t *testing.T) {
+	tests := []struct {
+		name   string
+		x, y   []float64
+		want   float64
+		wantOK bool
+	}{
+		{"perfect positive", []float64{1, 2, 3, 4}, []float64{2, 4, 6, 8}, 1, true},
+		{"perfect negative", []float64{1, 2, 3}, []float64{3, 2, 1}, -1, true},
+		{"partial", []float64{1, 2, 3}, []float64{1, 3, 2}, 0.5, true},
+		{"uncorrelated", []float64{1, 2, 3}, []float64{1, 0, 1}, 0, true},
+		{"constant x", []float64{2, 2, 2}, []float64{1, 2, 3}, 0, false},
+		{"constant y", []float64{1, 2, 3}, []float64{5, 5, 5}, 0, false},
+		{"too few points", []float64{1, 2}, []float64{2, 1}, 0, false},
+		{"empty", nil, nil, 0, false},
+		{"length mismatch", []float64{1, 2, 3}, []float64{1, 2}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Pearson(tt.x, tt.y)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > tolerance {
+				t.Errorf("Pearson(%v, %v) = %v, %v, want %v, %v", tt.x, tt.y, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSpearman(t *testing.T) {
+	tests := []struct {
+		name   string
+		x, y   []float64
+		want   float64
+		wantOK bool
+	}{
+		{"monotonic but not linear", []float64{1, 2, 3, 4}, []float64{1, 8, 27, 64}, 1, true},
+		{"reversed ranks", []float64{10, 20, 30}, []float64{0.3, 0.2, 0.1}, -1, true},
+		// Ranks of y are 1, 2.5, 2.5, 4
+		{"ties share a rank", []float64{1, 2, 3, 4}, []float64{1, 5, 5, 9}, 4.5 / math.Sqrt(5*4.5), true},
+		{"constant series", []float64{1, 2, 3}, []float64{4, 4, 4}, 0, false},
+		{"too few points", []float64{1, 2}, []float64{1, 2}, 0, false},
+		{"length mismatch", []float64{1, 2, 3}, []float64{1, 2}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Spearman(tt.x, tt.y)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > tolerance {
+				t.Errorf("Spearman(%v, %v) = %v, %v, want %v, %v", tt.x, tt.y, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRanks(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   []float64
+	}{
+		{[]float64{30, 10, 20}, []float64{3, 1, 2}},
+		{[]float64{5, 1, 5, 3}, []float64{3.5, 1, 3.5, 2}},
+		{[]float64{7, 7, 7}, []float64{2, 2, 2}},
+		{[]float64{}, []float64{}},
+	}
+
+	for _, tt := range tests {
+		if got := ranks(tt.values); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ranks(%v) = %v, want %v", tt.values, got, tt.want)
+		}
+	}
+}
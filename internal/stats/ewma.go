@@ -0,0 +1,44 @@
+package stats
+
+import "math"
+
+// EWMA tracks an exponentially weighted moving mean and variance. Alpha,
+// between 0 and 1, is the weight of each new sample; a smaller Alpha
+// remembers more history.
+type EWMA struct {
+	Alpha    float64
+	Mean     float64
+	Variance float64
+	// Count is the number of samples seen
+	Count int
+}
+
+// StdDev returns the square root of the variance
+func (e *EWMA) StdDev() float64 {
+	return math.Sqrt(e.Variance)
+}
+
+// ZScore returns how many standard deviations x is from the mean, using
+// minStdDev when the deviation is smaller so that a nearly constant series
+// doesn't turn every small move into an outlier. ok is false before the
+// first sample.
+func (e *EWMA) ZScore(x, minStdDev float64) (z float64, ok bool) {
+	if e.Count == 0 {
+		return 0, false
+	}
+	return (x - e.Mean) / math.Max(e.StdDev(), minStdDev), true
+}
+
+// Add folds x into the mean and variance. The first sample sets the mean.
+func (e *EWMA) Add(x float64) {
+	e.Count++
+	if e.Count == 1 {
+		e.Mean = x
+		return
+	}
+
+	diff := x - e.Mean
+	increment := e.Alpha * diff
+	e.Mean += increment
+	e.Variance = (1 - e.Alpha) * (e.Variance + diff*increment)
+}
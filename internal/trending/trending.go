@@ -0,0 +1,194 @@
+package trending
+
+import (
+	"crypto-sentiment/internal/catalog"
+	"crypto-sentiment/internal/models"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Rankings of discovered coins. Velocity ranks by MentionDelta, shift by
+// the size of ScoreDelta and mentions by Mentions.
+const (
+	RankVelocity = "velocity"
+	RankShift    = "shift"
+	RankMentions = "mentions"
+)
+
+// Defaults for the Config settings
+const (
+	defaultWindow      = time.Hour
+	defaultBaseline    = 6 * time.Hour
+	defaultMinMentions = 3
+	defaultSamples     = 3
+)
+
+// Config sets the windows mentions are counted over. Zero values take
+// their defaults.
+type Config struct {
+	// Window is the recent period whose mentions are ranked
+	Window time.Duration
+	// Baseline is the period before Window that it is compared with
+	Baseline time.Duration
+	// MinMentions leaves out coins mentioned fewer times within Window
+	MinMentions int
+	// Samples is how many posts are returned per coin
+	Samples int
+}
+
+// Validate fills in the defaults and checks the bounds
+func (c *Config) Validate() error {
+	if c.Window == 0 {
+		c.Window = defaultWindow
+	}
+	if c.Baseline == 0 {
+		c.Baseline = defaultBaseline
+	}
+	if c.MinMentions == 0 {
+		c.MinMentions = defaultMinMentions
+	}
+	if c.Samples == 0 {
+		c.Samples = defaultSamples
+	}
+
+	if c.Window < 0 || c.Baseline < 0 {
+		return fmt.Errorf("window and baseline must be positive")
+	}
+	if c.MinMentions < 1 {
+		return fmt.Errorf("min mentions must be at least 1")
+	}
+	if c.Samples < 0 {
+		return fmt.Errorf("samples must not be negative")
+	}
+	return nil
+}
+
+// Trend is a coin mentioned in the collected posts. MentionDelta is the
+// relative change of its hourly mention rate against the baseline, where
+// a baseline below one mention per hour counts as one: 1 means twice as
+// many mentions per hour. MentionScore is the average sentiment of the
+// posts mentioning it within the window, and ScoreDelta its change from
+// the baseline, which is nil without baseline mentions.
+type Trend struct {
+	Symbol           string              `json:"symbol"`
+	Name             string              `json:"name,omitempty"`
+	Mentions         int                 `json:"mentions"`
+	BaselineMentions int                 `json:"baseline_mentions"`
+	MentionDelta     float64             `json:"mention_delta"`
+	MentionScore     float64             `json:"mention_score"`
+	BaselineScore    *float64            `json:"baseline_score"`
+	ScoreDelta       *float64            `json:"score_delta"`
+	SamplePosts      []models.SocialPost `json:"sample_posts"`
+}
+
+// Discover counts the coins mentioned in posts within the window and the
+// baseline before it, ending at now, and returns those mentioned at least
+// MinMentions times within the window, most mentioned first
+func Discover(posts []models.SocialPost, coins *catalog.Catalog, now time.Time, config Config) []Trend {
+	windowStart := now.Add(-config.Window)
+	baselineStart := windowStart.Add(-config.Baseline)
+
+	type tally struct {
+		mentions, baseline int
+		score, baseScore   float64
+		posts              []models.SocialPost
+	}
+	tallies := make(map[string]*tally)
+	for _, post := range posts {
+		if post.CreatedAt.Before(baselineStart) || post.CreatedAt.After(now) {
+			continue
+		}
+		recent := !post.CreatedAt.Before(windowStart)
+
+		for _, symbol := range coins.Mentions(post.Content) {
+			t, ok := tallies[symbol]
+			if !ok {
+				t = &tally{}
+				tallies[symbol] = t
+			}
+			if recent {
+				t.mentions++
+				t.score += post.Sentiment
+				t.posts = append(t.posts, post)
+			} else {
+				t.baseline++
+				t.baseScore += post.Sentiment
+			}
+		}
+	}
+
+	var trends []Trend
+	for symbol, t := range tallies {
+		if t.mentions < config.MinMentions {
+			continue
+		}
+
+		trend := Trend{
+			Symbol:           symbol,
+			Mentions:         t.mentions,
+			BaselineMentions: t.baseline,
+			MentionScore:     t.score / float64(t.mentions),
+			SamplePosts:      samples(t.posts, config.Samples),
+		}
+		if coin, err := coins.Resolve(symbol); err == nil {
+			trend.Name = coin.Name
+		}
+
+		rate := float64(t.mentions) / config.Window.Hours()
+		baseRate := 0.0
+		if config.Baseline > 0 {
+			baseRate = float64(t.baseline) / config.Baseline.Hours()
+		}
+		trend.MentionDelta = (rate - baseRate) / math.Max(baseRate, 1)
+
+		if t.baseline > 0 {
+			baseScore := t.baseScore / float64(t.baseline)
+			delta := trend.MentionScore - baseScore
+			trend.BaselineScore = &baseScore
+			trend.ScoreDelta = &delta
+		}
+		trends = append(trends, trend)
+	}
+
+	Sort(trends, RankMentions)
+	return trends
+}
+
+// Sort orders trends by rank, breaking ties by mentions and then symbol.
+// Under RankShift, trends without a ScoreDelta come last.
+func Sort(trends []Trend, rank string) {
+	sort.SliceStable(trends, func(i, j int) bool {
+		a, b := trends[i], trends[j]
+		switch rank {
+		case RankVelocity:
+			if a.MentionDelta != b.MentionDelta {
+				return a.MentionDelta > b.MentionDelta
+			}
+		case RankShift:
+			if (a.ScoreDelta == nil) != (b.ScoreDelta == nil) {
+				return a.ScoreDelta != nil
+			}
+			if a.ScoreDelta != nil && math.Abs(*a.ScoreDelta) != math.Abs(*b.ScoreDelta) {
+				return math.Abs(*a.ScoreDelta) > math.Abs(*b.ScoreDelta)
+			}
+		}
+		if a.Mentions != b.Mentions {
+			return a.Mentions > b.Mentions
+		}
+		return a.Symbol < b.Symbol
+	})
+}
+
+// samples returns up to n of posts with the strongest sentiment
+func samples(posts []models.SocialPost, n int) []models.SocialPost {
+	sorted := append([]models.SocialPost(nil), posts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return math.Abs(sorted[i].Sentiment) > math.Abs(sorted[j].Sentiment)
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}